@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	AuditLogFile = getEnvStr("AUDIT_LOG_FILE", "") // JSON lines file for security events, the standard log if unset
+
+	auditMutex sync.Mutex
+	auditFile  *os.File
+)
+
+// initAuditLog opens AUDIT_LOG_FILE for appending
+func initAuditLog() {
+	if AuditLogFile == "" {
+		return
+	}
+
+	f, err := os.OpenFile(AuditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Fatalf("Error opening AUDIT_LOG_FILE: %v", err)
+	}
+	auditFile = f
+}
+
+// audit records a security relevant event with its details
+func audit(event string, fields map[string]string) {
+	entry := map[string]string{
+		"time":  time.Now().UTC().Format(time.RFC3339),
+		"event": event,
+	}
+	for key, value := range fields {
+		entry[key] = value
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding audit entry: %v", err)
+		return
+	}
+
+	if auditFile == nil {
+		log.Printf("AUDIT %s", line)
+		return
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	if _, err := auditFile.Write(append(line, '\n')); err != nil {
+		log.Printf("Error writing audit log: %v", err)
+	}
+}
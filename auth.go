@@ -0,0 +1,356 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthConfig holds the authentication and TLS settings of a calendar
+// connection
+type AuthConfig struct {
+	Method   string // basic, bearer, digest or none
+	Username string
+	Password string
+	Token    string // Bearer token
+	CAFile   string // PEM bundle trusted in addition to system roots
+	CertFile string // PEM client certificate
+	KeyFile  string // PEM client key
+}
+
+// loadAuthConfig reads <prefix>AUTH, USERNAME, PASSWORD, TOKEN, CA_FILE,
+// CERT_FILE and KEY_FILE. Credentials can also be read from files named by
+// the same variables with a _FILE suffix, such as Docker secrets.
+func loadAuthConfig(prefix, defaultMethod string) AuthConfig {
+	cfg := AuthConfig{
+		Username: getEnvSecret(prefix+"USERNAME", ""),
+		Password: getEnvSecret(prefix+"PASSWORD", ""),
+		Token:    getEnvSecret(prefix+"TOKEN", ""),
+		CAFile:   getEnvStr(prefix+"CA_FILE", ""),
+		CertFile: getEnvStr(prefix+"CERT_FILE", ""),
+		KeyFile:  getEnvStr(prefix+"KEY_FILE", ""),
+	}
+
+	cfg.Method = strings.ToLower(getEnvStr(prefix+"AUTH", defaultMethod))
+	if cfg.Method == "" {
+		switch {
+		case cfg.Token != "":
+			cfg.Method = "bearer"
+		case cfg.Username != "":
+			cfg.Method = "basic"
+		default:
+			cfg.Method = "none"
+		}
+	}
+
+	return cfg
+}
+
+// newAuthHTTPClient builds an HTTP client applying the authentication
+// method and TLS settings
+func newAuthHTTPClient(cfg AuthConfig, timeout time.Duration) (*http.Client, error) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		base.TLSClientConfig = tlsConfig
+	}
+
+	var transport http.RoundTripper = base
+	switch cfg.Method {
+	case "", "none":
+	case "basic":
+		transport = &basicAuthTransport{
+			Username: cfg.Username,
+			Password: cfg.Password,
+			Base:     base,
+		}
+	case "bearer":
+		if cfg.Token == "" {
+			return nil, fmt.Errorf("bearer auth requires a token")
+		}
+		transport = &bearerAuthTransport{
+			Token: cfg.Token,
+			Base:  base,
+		}
+	case "digest":
+		transport = &digestAuthTransport{
+			Username: cfg.Username,
+			Password: cfg.Password,
+			Base:     base,
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth method: %s", cfg.Method)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}, nil
+}
+
+// newTLSConfig returns nil when no custom CA or client certificate is set
+func newTLSConfig(cfg AuthConfig) (*tls.Config, error) {
+	if cfg.CAFile == "" && cfg.CertFile == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" {
+		keyFile := cfg.KeyFile
+		if keyFile == "" {
+			keyFile = cfg.CertFile // Combined PEM file
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+type basicAuthTransport struct {
+	Username string
+	Password string
+	Base     http.RoundTripper
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.Username, t.Password)
+	return t.Base.RoundTrip(req)
+}
+
+type bearerAuthTransport struct {
+	Token string
+	Base  http.RoundTripper
+}
+
+func (t *bearerAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.Token)
+	return t.Base.RoundTrip(req)
+}
+
+// digestAuthTransport implements HTTP Digest authentication (RFC 7616).
+// The last challenge is reused so only the first request needs a retry.
+type digestAuthTransport struct {
+	Username string
+	Password string
+	Base     http.RoundTripper
+
+	mu        sync.Mutex
+	challenge *digestChallenge
+	nc        int
+}
+
+type digestChallenge struct {
+	Realm     string
+	Nonce     string
+	Opaque    string
+	Algorithm string
+	QOP       string
+}
+
+func (t *digestAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	challenge := t.challenge
+	t.mu.Unlock()
+
+	first := req.Clone(req.Context())
+	if challenge != nil {
+		if err := t.authorize(first, challenge); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.Base.RoundTrip(first)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge = parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+	if challenge == nil {
+		return resp, nil
+	}
+
+	// Retry with the new challenge, the request body has to be replayed
+	retry := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		retry.Body = body
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	t.mu.Lock()
+	t.challenge = challenge
+	t.nc = 0
+	t.mu.Unlock()
+
+	if err := t.authorize(retry, challenge); err != nil {
+		return nil, err
+	}
+	return t.Base.RoundTrip(retry)
+}
+
+// authorize sets the Authorization header answering the challenge
+func (t *digestAuthTransport) authorize(req *http.Request, c *digestChallenge) error {
+	var newHash func() hash.Hash
+	algorithm := strings.ToUpper(c.Algorithm)
+	switch strings.TrimSuffix(algorithm, "-SESS") {
+	case "", "MD5":
+		newHash = md5.New
+	case "SHA-256":
+		newHash = sha256.New
+	default:
+		return fmt.Errorf("unsupported digest algorithm: %s", c.Algorithm)
+	}
+
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+
+	t.mu.Lock()
+	t.nc++
+	nc := fmt.Sprintf("%08x", t.nc)
+	t.mu.Unlock()
+
+	cnonceBytes := make([]byte, 16)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return err
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+
+	uri := req.URL.RequestURI()
+	ha1 := h(t.Username + ":" + c.Realm + ":" + t.Password)
+	if strings.HasSuffix(algorithm, "-SESS") {
+		ha1 = h(ha1 + ":" + c.Nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	qop := ""
+	for _, q := range strings.Split(c.QOP, ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+
+	var response string
+	if qop != "" {
+		response = h(strings.Join([]string{ha1, c.Nonce, nc, cnonce, qop, ha2}, ":"))
+	} else {
+		response = h(ha1 + ":" + c.Nonce + ":" + ha2)
+	}
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		t.Username, c.Realm, c.Nonce, uri, response)
+	if c.Algorithm != "" {
+		header += ", algorithm=" + c.Algorithm
+	}
+	if c.Opaque != "" {
+		header += fmt.Sprintf(`, opaque="%s"`, c.Opaque)
+	}
+	if qop != "" {
+		header += fmt.Sprintf(`, qop=%s, nc=%s, cnonce="%s"`, qop, nc, cnonce)
+	}
+
+	req.Header.Set("Authorization", header)
+	return nil
+}
+
+// parseDigestChallenge parses a WWW-Authenticate header, returning nil
+// when it is not a Digest challenge
+func parseDigestChallenge(header string) *digestChallenge {
+	if !strings.HasPrefix(strings.ToLower(header), "digest ") {
+		return nil
+	}
+
+	c := &digestChallenge{}
+	for _, param := range splitDigestParams(header[len("digest "):]) {
+		key, value, found := strings.Cut(param, "=")
+		if !found {
+			continue
+		}
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "realm":
+			c.Realm = value
+		case "nonce":
+			c.Nonce = value
+		case "opaque":
+			c.Opaque = value
+		case "algorithm":
+			c.Algorithm = value
+		case "qop":
+			c.QOP = value
+		}
+	}
+
+	if c.Nonce == "" {
+		return nil
+	}
+	return c
+}
+
+// splitDigestParams splits on commas outside quoted strings
+func splitDigestParams(s string) []string {
+	var (
+		params  []string
+		current strings.Builder
+		quoted  bool
+	)
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case r == ',' && !quoted:
+			params = append(params, current.String())
+			current.Reset()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	return append(params, current.String())
+}
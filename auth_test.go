@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var digestParamPattern = regexp.MustCompile(`(\w+)=(?:"([^"]*)"|([^,\s]+))`)
+
+// digestServer answers requests with a Digest challenge and accepts only
+// correct responses for user:secret
+func digestServer(t *testing.T, algorithm string, newHash func() hash.Hash) (*httptest.Server, *int32) {
+	t.Helper()
+
+	h := func(s string) string {
+		hh := newHash()
+		io.WriteString(hh, s)
+		return hex.EncodeToString(hh.Sum(nil))
+	}
+	const realm, nonce = "calendar", "dcd98b7102dd2f0e8b11d0f600bfb0c093"
+	var challenges int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Digest ") {
+			atomic.AddInt32(&challenges, 1)
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="%s", qop="auth,auth-int", nonce="%s", opaque="xyz", algorithm=%s`, realm, nonce, algorithm))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		params := make(map[string]string)
+		for _, match := range digestParamPattern.FindAllStringSubmatch(header, -1) {
+			params[match[1]] = match[2] + match[3]
+		}
+		ha1 := h("user:" + realm + ":secret")
+		ha2 := h(r.Method + ":" + r.URL.RequestURI())
+		want := h(strings.Join([]string{ha1, nonce, params["nc"], params["cnonce"], "auth", ha2}, ":"))
+		if params["response"] != want || params["username"] != "user" || params["opaque"] != "xyz" || params["uri"] != r.URL.RequestURI() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "ok %s", body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &challenges
+}
+
+func TestDigestAuth(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		newHash   func() hash.Hash
+	}{
+		{"MD5", md5.New},
+		{"SHA-256", sha256.New},
+	}
+
+	for _, test := range tests {
+		t.Run(test.algorithm, func(t *testing.T) {
+			server, challenges := digestServer(t, test.algorithm, test.newHash)
+			client, err := newAuthHTTPClient(AuthConfig{Method: "digest", Username: "user", Password: "secret"}, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, body := range []string{"first", "second", "third"} {
+				resp, err := client.Post(server.URL+"/calendars/user/?depth=1", "text/plain", strings.NewReader(body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, _ := io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if resp.StatusCode != http.StatusOK || string(got) != "ok "+body {
+					t.Fatalf("request %d: status %d, body %q", i+1, resp.StatusCode, got)
+				}
+			}
+
+			// The challenge is reused after the first request
+			if n := atomic.LoadInt32(challenges); n != 1 {
+				t.Errorf("server sent %d challenges, want 1", n)
+			}
+		})
+	}
+}
+
+func TestDigestAuthWrongPassword(t *testing.T) {
+	server, _ := digestServer(t, "MD5", md5.New)
+	client, err := newAuthHTTPClient(AuthConfig{Method: "digest", Username: "user", Password: "wrong"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", resp.StatusCode)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	client, err := newAuthHTTPClient(AuthConfig{Method: "bearer", Token: "s3cr3t"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	if _, err := newAuthHTTPClient(AuthConfig{Method: "bearer"}, time.Second); err == nil {
+		t.Error("bearer auth without a token was accepted")
+	}
+}
+
+func TestParseDigestChallenge(t *testing.T) {
+	tests := []struct {
+		header string
+		want   *digestChallenge
+	}{
+		{
+			header: `Digest realm="a, b", nonce="n1", qop="auth,auth-int", algorithm=SHA-256, opaque="o"`,
+			want:   &digestChallenge{Realm: "a, b", Nonce: "n1", QOP: "auth,auth-int", Algorithm: "SHA-256", Opaque: "o"},
+		},
+		{
+			header: `digest nonce=n2`,
+			want:   &digestChallenge{Nonce: "n2"},
+		},
+		{header: `Basic realm="calendar"`},
+		{header: `Digest realm="no nonce"`},
+	}
+
+	for _, test := range tests {
+		got := parseDigestChallenge(test.header)
+		switch {
+		case test.want == nil && got != nil:
+			t.Errorf("parseDigestChallenge(%q) = %+v, want nil", test.header, got)
+		case test.want != nil && (got == nil || *got != *test.want):
+			t.Errorf("parseDigestChallenge(%q) = %+v, want %+v", test.header, got, test.want)
+		}
+	}
+}
+
+func TestLoadAuthConfigMethod(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want string
+	}{
+		{map[string]string{}, "none"},
+		{map[string]string{"TEST_USERNAME": "user"}, "basic"},
+		{map[string]string{"TEST_TOKEN": "token"}, "bearer"},
+		{map[string]string{"TEST_USERNAME": "user", "TEST_AUTH": "Digest"}, "digest"},
+	}
+
+	for _, test := range tests {
+		for _, key := range []string{"TEST_AUTH", "TEST_USERNAME", "TEST_TOKEN"} {
+			t.Setenv(key, test.env[key])
+		}
+		if got := loadAuthConfig("TEST_", "").Method; got != test.want {
+			t.Errorf("method with %v = %q, want %q", test.env, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	AvailabilityMode     = strings.ToLower(getEnvStr("AVAILABILITY_MODE", "hours")) // hours, calendar or vavailability
+	AvailabilityCalendar = getEnvStr("AVAILABILITY_CALENDAR", "")                   // Calendar whose events are bookable windows
+
+	availability AvailabilitySource
+)
+
+// AvailabilitySource reports the windows in which slots can be offered.
+// Busy time is subtracted from these windows afterwards.
+type AvailabilitySource interface {
+	Windows(ctx context.Context, start, end time.Time) ([]Interval, error)
+}
+
+// workingHours offers WORKDAY_START to WORKDAY_END on every working day
+type workingHours struct{}
+
+func (workingHours) Windows(ctx context.Context, start, end time.Time) ([]Interval, error) {
+	var windows []Interval
+	for day := start.UTC().Truncate(24 * time.Hour); day.Before(end); day = day.AddDate(0, 0, 1) {
+		if !isWorkingDay(day) {
+			continue
+		}
+		windows = append(windows, Interval{
+			Start: day.Add(time.Duration(WorkDayStartHour) * time.Hour),
+			End:   day.Add(time.Duration(WorkDayEndHour) * time.Hour),
+		})
+	}
+	return clipIntervals(windows, start, end), nil
+}
+
+// calendarAvailability treats every event of a calendar, such as recurring
+// "Office hours" blocks, as a bookable window
+type calendarAvailability struct {
+	source BusySource
+}
+
+func (a calendarAvailability) Windows(ctx context.Context, start, end time.Time) ([]Interval, error) {
+	events, err := a.source.ListBusy(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return mergeIntervals(clipIntervals(events, start, end)), nil
+}
+
+// initAvailability selects the availability source for AVAILABILITY_MODE
+func initAvailability() {
+	switch AvailabilityMode {
+	case "hours":
+		availability = workingHours{}
+	case "calendar":
+		source := availabilityCalendarSource()
+		availability = calendarAvailability{source: source}
+		log.Printf("Availability defined by calendar: %s", AvailabilityCalendar)
+	case "vavailability":
+		source := newVAvailabilitySource()
+		availability = source
+		log.Printf("Availability defined by %s", source)
+	default:
+		log.Fatalf("Unknown AVAILABILITY_MODE: %s", AvailabilityMode)
+	}
+}
+
+// availabilityCalendarSource opens AVAILABILITY_CALENDAR, either an ICS
+// file or URL, or a calendar path on the CalDAV server
+func availabilityCalendarSource() BusySource {
+	if AvailabilityCalendar == "" {
+		log.Fatalf("AVAILABILITY_CALENDAR is required when AVAILABILITY_MODE=calendar")
+	}
+
+	if isICSLocation(AvailabilityCalendar) {
+		source := &ICSSource{
+			Name:    "availability",
+			URL:     AvailabilityCalendar,
+			Mode:    "busy",
+			Refresh: time.Duration(getEnvInt("AVAILABILITY_REFRESH", 15)) * time.Minute,
+		}
+		client, err := newAuthHTTPClient(loadAuthConfig("AVAILABILITY_", ""), 30*time.Second)
+		if err != nil {
+			log.Fatalf("Error configuring availability calendar: %v", err)
+		}
+		source.client = client
+
+		if err := source.fetch(context.Background()); err != nil {
+			log.Printf("Error loading availability calendar: %v", err)
+		}
+		go source.refreshLoop()
+		return source
+	}
+
+	if caldavClient == nil {
+		log.Fatalf("AVAILABILITY_CALENDAR must be an ICS file or URL unless CALENDAR_BACKEND=caldav")
+	}
+	return newCalDAVBackend(caldavClient, []string{AvailabilityCalendar})
+}
+
+// isICSLocation reports whether a calendar reference is an ICS file or URL
+// rather than a CalDAV calendar path
+func isICSLocation(location string) bool {
+	for _, prefix := range []string{"http://", "https://", "webcal://", "file://"} {
+		if strings.HasPrefix(location, prefix) {
+			return true
+		}
+	}
+	return strings.HasSuffix(strings.ToLower(location), ".ics")
+}
+
+// isWorkingDay checks the day against WORKING_DAYS
+func isWorkingDay(date time.Time) bool {
+	for _, workday := range workingWeekdays {
+		if date.Weekday() == workday {
+			return true
+		}
+	}
+	return false
+}
+
+// clipIntervals trims intervals to the range and drops those outside it
+func clipIntervals(intervals []Interval, start, end time.Time) []Interval {
+	var clipped []Interval
+	for _, interval := range intervals {
+		if interval.Start.Before(start) {
+			interval.Start = start
+		}
+		if interval.End.After(end) {
+			interval.End = end
+		}
+		if interval.Start.Before(interval.End) {
+			clipped = append(clipped, interval)
+		}
+	}
+	return clipped
+}
+
+// mergeIntervals sorts intervals and joins overlapping or adjacent ones
+func mergeIntervals(intervals []Interval) []Interval {
+	if len(intervals) == 0 {
+		return nil
+	}
+
+	sorted := append([]Interval(nil), intervals...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	merged := []Interval{{Start: sorted[0].Start, End: sorted[0].End}}
+	for _, interval := range sorted[1:] {
+		last := &merged[len(merged)-1]
+		if !interval.Start.After(last.End) {
+			if interval.End.After(last.End) {
+				last.End = interval.End
+			}
+			continue
+		}
+		merged = append(merged, Interval{Start: interval.Start, End: interval.End})
+	}
+	return merged
+}
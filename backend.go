@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// Interval is a half-open time range [Start, End)
+type Interval struct {
+	Start time.Time
+	End   time.Time
+	UID   string // UID of the event the interval comes from, if any
+
+	Attendees int // Number of attendees of the event, used for group sessions
+}
+
+// Overlaps reports whether two intervals share any time
+func (i Interval) Overlaps(other Interval) bool {
+	return i.Start.Before(other.End) && i.End.After(other.Start)
+}
+
+// ErrEventNotFound is returned when no event has the requested UID
+var ErrEventNotFound = errors.New("event not found")
+
+// BusySource reports busy time in a range
+type BusySource interface {
+	ListBusy(ctx context.Context, start, end time.Time) ([]Interval, error)
+}
+
+// CalendarBackend stores booking events and reports busy time
+type CalendarBackend interface {
+	BusySource
+
+	// CreateEvent stores a calendar object holding a single event
+	CreateEvent(ctx context.Context, cal *ical.Calendar) error
+	// UpdateEvent replaces the calendar object holding the event with the same UID
+	UpdateEvent(ctx context.Context, cal *ical.Calendar) error
+	// DeleteEvent removes the calendar object with the given event UID
+	DeleteEvent(ctx context.Context, uid string) error
+	// FindByUID returns the calendar object with the given event UID
+	FindByUID(ctx context.Context, uid string) (*ical.Calendar, error)
+}
+
+var (
+	CalendarBackendType = getEnvStr("CALENDAR_BACKEND", "caldav")  // caldav, ics or memory
+	ICSDirectory        = getEnvStr("ICS_DIRECTORY", "./calendar") // Directory for the ics backend
+
+	backend     CalendarBackend
+	busySources []BusySource // Read-only calendars merged into busy time
+)
+
+// initBackend creates the calendar backend selected by CALENDAR_BACKEND
+func initBackend() {
+	switch strings.ToLower(CalendarBackendType) {
+	case "caldav":
+		initCalDAVClient()
+		backend = newCalDAVBackend(caldavClient, busyCalendarPaths())
+	case "ics":
+		b, err := NewICSDirBackend(ICSDirectory)
+		if err != nil {
+			log.Fatalf("Error initializing ICS backend: %v", err)
+		}
+		backend = b
+	case "memory":
+		backend = NewMemoryBackend()
+	default:
+		log.Fatalf("Unknown CALENDAR_BACKEND: %s", CalendarBackendType)
+	}
+
+	log.Printf("Calendar backend: %s", CalendarBackendType)
+}
+
+// busyCalendarPaths returns the primary and additional calendars on the
+// CalDAV server
+func busyCalendarPaths() []string {
+	paths := []string{caldavConfig.Calendar}
+	for _, cal := range caldavConfig.AdditionalCalendars {
+		if cal = strings.TrimSpace(cal); cal != "" {
+			paths = append(paths, cal)
+		}
+	}
+	return paths
+}
+
+// listAllBusy merges busy time of the backend and every read-only source.
+// It only fails when nothing could be loaded at all.
+func listAllBusy(ctx context.Context, start, end time.Time) ([]Interval, error) {
+	sources := append([]BusySource{backend}, busySources...)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		all      []Interval
+		firstErr error
+		failures int
+	)
+
+	for _, source := range sources {
+		wg.Add(1)
+		go func(s BusySource) {
+			defer wg.Done()
+
+			intervals, err := s.ListBusy(ctx, start, end)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures++
+				if firstErr == nil {
+					firstErr = err
+				}
+				return
+			}
+			all = append(all, intervals...)
+		}(source)
+	}
+	wg.Wait()
+
+	if failures == len(sources) {
+		return nil, firstErr
+	}
+	return all, nil
+}
+
+// eventIntervals expands an event and returns the instances overlapping
+// the range as intervals, leaving out the instances in skip
+func eventIntervals(event *ical.Component, start, end time.Time, skip []time.Time) []Interval {
+	var intervals []Interval
+
+	// Cancelled events stay in some calendars but no longer take up time
+	if status, _ := event.Props.Text(ical.PropStatus); strings.EqualFold(status, "CANCELLED") {
+		return nil
+	}
+
+	uid, _ := event.Props.Text(ical.PropUID)
+	attendees := len(event.Props.Values(ical.PropAttendee))
+	for _, instance := range expandRecurringEvent(event, start, end, skip) {
+		dtstart := instance.Props.Get(ical.PropDateTimeStart)
+		if dtstart == nil {
+			continue
+		}
+
+		instanceStart, err := dtstart.DateTime(time.UTC)
+		if err != nil {
+			continue
+		}
+
+		intervals = append(intervals, Interval{
+			Start: instanceStart.UTC(),
+			End:   instanceStart.Add(eventDuration(instance, instanceStart)).UTC(),
+			UID:   uid,
+
+			Attendees: attendees,
+		})
+	}
+
+	return intervals
+}
+
+// componentIntervals expands a list of events, or of AVAILABLE components.
+// A component with a RECURRENCE-ID replaces that instance of the recurring
+// component with the same UID.
+func componentIntervals(components []*ical.Component, start, end time.Time) []Interval {
+	overrides := make(map[string][]time.Time)
+	for _, component := range components {
+		prop := component.Props.Get(ical.PropRecurrenceID)
+		if prop == nil {
+			continue
+		}
+		if recurrenceID, err := prop.DateTime(time.UTC); err == nil {
+			uid, _ := component.Props.Text(ical.PropUID)
+			overrides[uid] = append(overrides[uid], recurrenceID)
+		}
+	}
+
+	var intervals []Interval
+	for _, component := range components {
+		var skip []time.Time
+		if component.Props.Get(ical.PropRecurrenceID) == nil {
+			uid, _ := component.Props.Text(ical.PropUID)
+			skip = overrides[uid]
+		}
+		intervals = append(intervals, eventIntervals(component, start, end, skip)...)
+	}
+	return intervals
+}
+
+// calendarIntervals collects intervals of every event in the calendars
+func calendarIntervals(cals []*ical.Calendar, start, end time.Time) []Interval {
+	var intervals []Interval
+	for _, cal := range cals {
+		intervals = append(intervals, componentIntervals(componentsByName(cal, ical.CompEvent), start, end)...)
+	}
+	return intervals
+}
+
+// objectName returns the calendar object file name for an event UID
+func objectName(uid string) string {
+	name := strings.SplitN(uid, "@", 2)[0]
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+	return name + ".ics"
+}
+
+// calendarUID returns the UID of the first event in a calendar object
+func calendarUID(cal *ical.Calendar) string {
+	if event := calendarEvent(cal); event != nil {
+		uid, _ := event.Props.Text(ical.PropUID)
+		return uid
+	}
+	return ""
+}
+
+// calendarEvent returns the first event in a calendar object
+func calendarEvent(cal *ical.Calendar) *ical.Component {
+	for _, component := range cal.Children {
+		if component.Name == ical.CompEvent {
+			return component
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// caldavBackend reads busy time from a set of calendars on one CalDAV
+// server and writes bookings to the server's default calendar
+type caldavBackend struct {
+	client    *caldav.Client
+	calendars []string // Calendars checked for busy time
+
+	mu           sync.Mutex
+	calendarPath string // Resolved calendar for new bookings
+}
+
+func newCalDAVBackend(client *caldav.Client, calendars []string) *caldavBackend {
+	return &caldavBackend{
+		client:    client,
+		calendars: calendars,
+	}
+}
+
+func (b *caldavBackend) ListBusy(ctx context.Context, start, end time.Time) ([]Interval, error) {
+	// Load all events from a wider range to catch recurring events
+	// that might start before our target date but recur on it
+	query := &caldav.CalendarQuery{
+		CompFilter: caldav.CompFilter{
+			Name: "VCALENDAR",
+			Comps: []caldav.CompFilter{{
+				Name:  "VEVENT",
+				Start: start.AddDate(-1, 0, 0), // 1 year back
+				End:   end.AddDate(1, 0, 0),    // 1 year forward
+			}},
+		},
+	}
+
+	// Use WaitGroup for parallel calendar processing
+	var wg sync.WaitGroup
+	calsChan := make(chan []*ical.Calendar, len(b.calendars))
+	errChan := make(chan error, len(b.calendars))
+
+	for _, calendar := range b.calendars {
+		wg.Add(1)
+		go func(cal string) {
+			defer wg.Done()
+
+			calendarObjects, err := b.client.QueryCalendar(ctx, cal, query)
+			if err != nil {
+				log.Printf("Error querying calendar %s: %v", cal, err)
+				errChan <- err
+				return
+			}
+
+			var cals []*ical.Calendar
+			for _, obj := range calendarObjects {
+				if obj.Data != nil {
+					cals = append(cals, obj.Data)
+				}
+			}
+			calsChan <- cals
+		}(calendar)
+	}
+
+	wg.Wait()
+	close(calsChan)
+	close(errChan)
+
+	var cals []*ical.Calendar
+	for c := range calsChan {
+		cals = append(cals, c...)
+	}
+
+	// If every calendar failed, return error
+	if len(errChan) == len(b.calendars) && len(errChan) > 0 {
+		return nil, <-errChan
+	}
+
+	return calendarIntervals(cals, start, end), nil
+}
+
+// bookingCalendarPath finds the calendar new bookings are written to
+func (b *caldavBackend) bookingCalendarPath(ctx context.Context) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.calendarPath != "" {
+		return b.calendarPath, nil
+	}
+
+	calendars, err := b.client.FindCalendars(ctx, "")
+	if err != nil {
+		return "", fmt.Errorf("error getting calendars: %w", err)
+	}
+
+	var calendarPath string
+	for _, cal := range calendars {
+		log.Printf("Found calendar: %s", cal.Path)
+		if strings.Contains(cal.Path, "default") || len(calendars) == 1 {
+			calendarPath = cal.Path
+			break
+		}
+	}
+
+	if calendarPath == "" && len(calendars) > 0 {
+		calendarPath = calendars[0].Path
+	}
+
+	if calendarPath == "" {
+		return "", fmt.Errorf("no suitable calendar found")
+	}
+
+	log.Printf("Using calendar: %s", calendarPath)
+	b.calendarPath = calendarPath
+	return calendarPath, nil
+}
+
+// findObject locates the calendar object of an event, first by its
+// conventional path and then by querying the UID
+func (b *caldavBackend) findObject(ctx context.Context, uid string) (*caldav.CalendarObject, error) {
+	calendarPath, err := b.bookingCalendarPath(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if obj, err := b.client.GetCalendarObject(ctx, calendarPath+objectName(uid)); err == nil {
+		return obj, nil
+	}
+
+	query := &caldav.CalendarQuery{
+		CompRequest: caldav.CalendarCompRequest{Name: "VCALENDAR", AllProps: true, AllComps: true},
+		CompFilter: caldav.CompFilter{
+			Name: "VCALENDAR",
+			Comps: []caldav.CompFilter{{
+				Name: "VEVENT",
+				Props: []caldav.PropFilter{{
+					Name:      ical.PropUID,
+					TextMatch: &caldav.TextMatch{Text: uid},
+				}},
+			}},
+		},
+	}
+
+	objects, err := b.client.QueryCalendar(ctx, calendarPath, query)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		if objects[i].Data != nil && calendarUID(objects[i].Data) == uid {
+			return &objects[i], nil
+		}
+	}
+
+	return nil, ErrEventNotFound
+}
+
+func (b *caldavBackend) CreateEvent(ctx context.Context, cal *ical.Calendar) error {
+	calendarPath, err := b.bookingCalendarPath(ctx)
+	if err != nil {
+		return err
+	}
+
+	eventPath := calendarPath + objectName(calendarUID(cal))
+	log.Printf("Attempting to create event at path: %s", eventPath)
+
+	if _, err := b.client.PutCalendarObject(ctx, eventPath, cal); err != nil {
+		return fmt.Errorf("error creating CalDAV event: %w", err)
+	}
+	return nil
+}
+
+func (b *caldavBackend) UpdateEvent(ctx context.Context, cal *ical.Calendar) error {
+	obj, err := b.findObject(ctx, calendarUID(cal))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Attempting to update event at path: %s", obj.Path)
+	if _, err := b.client.PutCalendarObject(ctx, obj.Path, cal); err != nil {
+		return fmt.Errorf("error updating CalDAV event: %w", err)
+	}
+	return nil
+}
+
+func (b *caldavBackend) DeleteEvent(ctx context.Context, uid string) error {
+	obj, err := b.findObject(ctx, uid)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Attempting to delete event at path: %s", obj.Path)
+	if err := b.client.RemoveAll(ctx, obj.Path); err != nil {
+		return fmt.Errorf("error deleting event from CalDAV: %w", err)
+	}
+	return nil
+}
+
+func (b *caldavBackend) FindByUID(ctx context.Context, uid string) (*ical.Calendar, error) {
+	obj, err := b.findObject(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Data, nil
+}
+
+func initCalDAVClient() {
+	httpClient, err := newAuthHTTPClient(caldavConfig.Auth, 10*time.Second)
+	if err != nil {
+		log.Fatalf("Error initializing CalDAV client: %v", err)
+	}
+
+	caldavClient, err = caldav.NewClient(httpClient, caldavConfig.ServerURL)
+	if err != nil {
+		log.Fatalf("Error initializing CalDAV client: %v", err)
+	}
+
+	// Verify calendar availability
+	ctx := context.Background()
+	_, err = caldavClient.FindCalendars(ctx, "")
+	if err != nil {
+		log.Fatalf("Error accessing calendar: %v", err)
+	}
+
+	log.Println("CalDAV client successfully initialized and connected")
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// MemoryBackend keeps events in memory. It needs no calendar server and
+// suits demos and tests; everything is lost on restart.
+type MemoryBackend struct {
+	mu      sync.RWMutex
+	objects map[string]*ical.Calendar // Calendar objects by event UID
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		objects: make(map[string]*ical.Calendar),
+	}
+}
+
+func (b *MemoryBackend) ListBusy(ctx context.Context, start, end time.Time) ([]Interval, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	cals := make([]*ical.Calendar, 0, len(b.objects))
+	for _, cal := range b.objects {
+		cals = append(cals, cal)
+	}
+	return calendarIntervals(cals, start, end), nil
+}
+
+func (b *MemoryBackend) CreateEvent(ctx context.Context, cal *ical.Calendar) error {
+	uid := calendarUID(cal)
+	if uid == "" {
+		return fmt.Errorf("event has no UID")
+	}
+
+	b.mu.Lock()
+	b.objects[uid] = cal
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *MemoryBackend) UpdateEvent(ctx context.Context, cal *ical.Calendar) error {
+	uid := calendarUID(cal)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.objects[uid]; !exists {
+		return ErrEventNotFound
+	}
+	b.objects[uid] = cal
+	return nil
+}
+
+func (b *MemoryBackend) DeleteEvent(ctx context.Context, uid string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, exists := b.objects[uid]; !exists {
+		return ErrEventNotFound
+	}
+	delete(b.objects, uid)
+	return nil
+}
+
+func (b *MemoryBackend) FindByUID(ctx context.Context, uid string) (*ical.Calendar, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	cal, exists := b.objects[uid]
+	if !exists {
+		return nil, ErrEventNotFound
+	}
+	return cal, nil
+}
+
+// ICSDirBackend stores every event as an .ics file in a local directory.
+// Files dropped into the directory by other tools count as busy time too.
+type ICSDirBackend struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewICSDirBackend(dir string) (*ICSDirBackend, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &ICSDirBackend{dir: dir}, nil
+}
+
+// readAll parses every .ics file in the directory, keyed by file path
+func (b *ICSDirBackend) readAll() (map[string]*ical.Calendar, error) {
+	files, err := filepath.Glob(filepath.Join(b.dir, "*.ics"))
+	if err != nil {
+		return nil, err
+	}
+
+	cals := make(map[string]*ical.Calendar, len(files))
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		cal, err := ical.NewDecoder(f).Decode()
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", file, err)
+		}
+		cals[file] = cal
+	}
+	return cals, nil
+}
+
+// findFile returns the path of the file holding the event
+func (b *ICSDirBackend) findFile(uid string) (string, *ical.Calendar, error) {
+	cals, err := b.readAll()
+	if err != nil {
+		return "", nil, err
+	}
+	for file, cal := range cals {
+		if calendarUID(cal) == uid {
+			return file, cal, nil
+		}
+	}
+	return "", nil, ErrEventNotFound
+}
+
+func (b *ICSDirBackend) ListBusy(ctx context.Context, start, end time.Time) ([]Interval, error) {
+	b.mu.Lock()
+	cals, err := b.readAll()
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*ical.Calendar, 0, len(cals))
+	for _, cal := range cals {
+		list = append(list, cal)
+	}
+	return calendarIntervals(list, start, end), nil
+}
+
+func (b *ICSDirBackend) CreateEvent(ctx context.Context, cal *ical.Calendar) error {
+	uid := calendarUID(cal)
+	if uid == "" {
+		return fmt.Errorf("event has no UID")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.writeFile(filepath.Join(b.dir, objectName(uid)), cal)
+}
+
+func (b *ICSDirBackend) UpdateEvent(ctx context.Context, cal *ical.Calendar) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	file, _, err := b.findFile(calendarUID(cal))
+	if err != nil {
+		return err
+	}
+	return b.writeFile(file, cal)
+}
+
+// writeFile writes to a temporary file first so readers never see partial data
+func (b *ICSDirBackend) writeFile(path string, cal *ical.Calendar) error {
+	tmp, err := os.CreateTemp(b.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := ical.NewEncoder(tmp).Encode(cal); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (b *ICSDirBackend) DeleteEvent(ctx context.Context, uid string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	file, _, err := b.findFile(uid)
+	if err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+func (b *ICSDirBackend) FindByUID(ctx context.Context, uid string) (*ical.Calendar, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, cal, err := b.findFile(uid)
+	return cal, err
+}
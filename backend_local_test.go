@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// testBackendContract runs the CalendarBackend operations the booking code
+// relies on against a backend
+func testBackendContract(t *testing.T, b CalendarBackend) {
+	ctx := context.Background()
+	day := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	start := day.Add(10 * time.Hour)
+	uid := "3f6c1a9e-5b2d-4e8f-9a71-0c4d2e8b6f15@BookMyMeet"
+
+	busy := func() []Interval {
+		t.Helper()
+		intervals, err := b.ListBusy(ctx, day, day.Add(24*time.Hour))
+		if err != nil {
+			t.Fatalf("ListBusy: %v", err)
+		}
+		return intervals
+	}
+
+	cal, _ := newEventCalendar(uid, start, time.Hour, "Project review")
+	if err := b.CreateEvent(ctx, cal); err != nil {
+		t.Fatalf("CreateEvent: %v", err)
+	}
+	if intervals := busy(); len(intervals) != 1 || !intervals[0].Start.Equal(start) || intervals[0].UID != uid {
+		t.Fatalf("busy after create = %+v", intervals)
+	}
+
+	found, err := b.FindByUID(ctx, uid)
+	if err != nil {
+		t.Fatalf("FindByUID: %v", err)
+	}
+	event := calendarEvent(found)
+	if summary, _ := event.Props.Text(ical.PropSummary); summary != "Project review" {
+		t.Errorf("summary = %q", summary)
+	}
+
+	moved := start.Add(3 * time.Hour)
+	event.Props.SetDateTime(ical.PropDateTimeStart, moved)
+	event.Props.SetDateTime(ical.PropDateTimeEnd, moved.Add(time.Hour))
+	if err := b.UpdateEvent(ctx, found); err != nil {
+		t.Fatalf("UpdateEvent: %v", err)
+	}
+	if intervals := busy(); len(intervals) != 1 || !intervals[0].Start.Equal(moved) {
+		t.Fatalf("busy after update = %+v", intervals)
+	}
+
+	if err := b.DeleteEvent(ctx, uid); err != nil {
+		t.Fatalf("DeleteEvent: %v", err)
+	}
+	if intervals := busy(); len(intervals) != 0 {
+		t.Errorf("busy after delete = %+v", intervals)
+	}
+
+	if _, err := b.FindByUID(ctx, uid); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("FindByUID of a deleted event: %v", err)
+	}
+	if err := b.UpdateEvent(ctx, found); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("UpdateEvent of a deleted event: %v", err)
+	}
+	if err := b.DeleteEvent(ctx, uid); !errors.Is(err, ErrEventNotFound) {
+		t.Errorf("DeleteEvent of a deleted event: %v", err)
+	}
+}
+
+func TestMemoryBackend(t *testing.T) {
+	testBackendContract(t, NewMemoryBackend())
+}
+
+func TestICSDirBackend(t *testing.T) {
+	b, err := NewICSDirBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBackendContract(t, b)
+}
+
+func TestICSDirBackendForeignFiles(t *testing.T) {
+	dir := t.TempDir()
+	b, err := NewICSDirBackend(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	foreign := eventCalendar(`BEGIN:VEVENT
+UID:dentist
+DTSTAMP:20260101T000000Z
+DTSTART:20261020T080000Z
+DTEND:20261020T090000Z
+END:VEVENT
+BEGIN:VEVENT
+UID:called-off
+DTSTAMP:20260101T000000Z
+DTSTART:20261020T140000Z
+DTEND:20261020T150000Z
+STATUS:CANCELLED
+END:VEVENT`)
+	if err := os.WriteFile(filepath.Join(dir, "dentist.ics"), []byte(foreign), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2026, 10, 20, 0, 0, 0, 0, time.UTC)
+	intervals, err := b.ListBusy(context.Background(), day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intervals) != 1 || intervals[0].UID != "dentist" {
+		t.Errorf("busy = %+v, want only the dentist", intervals)
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
@@ -17,6 +19,7 @@ import (
 	"github.com/emersion/go-webdav/caldav"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/teambition/rrule-go"
 	"golang.org/x/time/rate"
 )
 
@@ -27,8 +30,7 @@ var (
 	WorkingDays             = getEnvStr("WORKING_DAYS", "mon,tue,wed,thu,fri,sat") // Working days
 
 	CalDAVServerURL           = getEnvStr("CALDAV_SERVER_URL", "")
-	CalDAVUsername            = getEnvStr("CALDAV_USERNAME", "")
-	CalDAVPassword            = getEnvStr("CALDAV_PASSWORD", "")
+	CalDAVAuth                = loadAuthConfig("CALDAV_", "")
 	CalDAVCalendar            = getEnvStr("CALDAV_CALENDAR", "")
 	CalDAVAdditionalCalendars = getEnvStrSlice("CALDAV_ADDITIONAL_CALENDARS", "")
 )
@@ -40,6 +42,19 @@ func getEnvStr(key, defaultValue string) string {
 	return defaultValue
 }
 
+// getEnvSecret reads a value from the variable itself or from the file
+// named by <key>_FILE, as used by Docker secrets
+func getEnvSecret(key, defaultValue string) string {
+	if path, exists := os.LookupEnv(key + "_FILE"); exists {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Error reading %s_FILE: %v", key, err)
+		}
+		return strings.TrimSpace(string(data))
+	}
+	return getEnvStr(key, defaultValue)
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value, exists := os.LookupEnv(key); exists {
 		if intValue, err := strconv.Atoi(value); err == nil {
@@ -92,58 +107,75 @@ func parseWeekdays(daysStr string) ([]time.Weekday, error) {
 }
 
 type BookingRequest struct {
-	Date        string `json:"date"`
-	Time        string `json:"time"`
-	Topic       string `json:"topic"`
-	FullName    string `json:"fullName"`
-	ContactInfo string `json:"contactInfo"`
-	CSRFToken   string `json:"_csrf"`
+	Date        string            `json:"date"`
+	Time        string            `json:"time"`
+	Topic       string            `json:"topic"`
+	FullName    string            `json:"fullName"`
+	ContactInfo string            `json:"contactInfo"`
+	MeetingType string            `json:"meetingType,omitempty"`
+	Duration    int               `json:"duration,omitempty"` // Minutes, the meeting type default if unset
+	Timezone    string            `json:"timezone,omitempty"` // IANA timezone of the booker, used in messages
+	Language    string            `json:"language,omitempty"` // Language tag of the booker, selects message templates
+	Guests      []string          `json:"guests,omitempty"`   // Email addresses of extra attendees, at most MAX_GUESTS
+	Phone       string            `json:"phone,omitempty"`    // Number to call for meeting types held by phone
+	Answers     map[string]any    `json:"answers,omitempty"`  // Answers to the meeting type's questions by question ID
+	Contacts    map[string]string `json:"contacts,omitempty"` // Contacts by channel, replacing contactInfo
+	CSRFToken   string            `json:"_csrf"`
+}
+
+// Slot is a start time offered for booking
+type Slot struct {
+	Time      string `json:"time"`
+	SeatsLeft int    `json:"seatsLeft,omitempty"` // Free seats of a group session
 }
 
 type BookingResponse struct {
-	Success bool   `json:"success"`
-	Code    string `json:"code,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Success   bool   `json:"success"`
+	Code      string `json:"code,omitempty"`
+	ManageURL string `json:"manageUrl,omitempty"`
+	Location  string `json:"location,omitempty"` // Where the meeting takes place
+	VideoURL  string `json:"videoUrl,omitempty"` // Link of a video meeting
+	Error     string `json:"error,omitempty"`
 }
 
 type CancelRequest struct {
 	Code      string `json:"code"`
+	Reason    string `json:"reason,omitempty"`
+	CSRFToken string `json:"_csrf"`
+}
+
+type RescheduleRequest struct {
+	Code      string `json:"code"`
+	Date      string `json:"date"`
+	Time      string `json:"time"`
 	CSRFToken string `json:"_csrf"`
 }
 
 type CalDAVConfig struct {
 	ServerURL           string
-	Username            string
-	Password            string
+	Auth                AuthConfig
 	Calendar            string
 	AdditionalCalendars []string
 }
 
-// RRule represents a recurrence rule
-type RRule struct {
-	Freq     string    // DAILY, WEEKLY, MONTHLY, YEARLY
-	Interval int       // Interval between recurrences
-	Count    int       // Number of occurrences (0 = unlimited)
-	Until    time.Time // End date for recurrences
-	ByDay    []string  // Days of week for WEEKLY (MO, TU, WE, etc.)
-}
-
 var caldavConfig = CalDAVConfig{
 	ServerURL:           CalDAVServerURL,
-	Username:            CalDAVUsername,
-	Password:            CalDAVPassword,
+	Auth:                CalDAVAuth,
 	Calendar:            CalDAVCalendar,
 	AdditionalCalendars: CalDAVAdditionalCalendars,
 }
 
 var (
 	limiter      = rate.NewLimiter(rate.Every(time.Minute), 100) // 100 requests per minute
-	bookingCodes = make(map[string]string)                       // In production use a database
 	caldavClient *caldav.Client
 
-	eventsCache      map[string][]*ical.Component // Events cache by date
+	eventsCache      map[string]DayEvents // Busy time and windows cache by date
 	eventsCacheMutex sync.RWMutex
 
+	// Serializes checking a slot and taking it, so that two requests
+	// cannot both find it free
+	bookingMutex sync.Mutex
+
 	// Parsed working weekdays
 	workingWeekdays []time.Weekday
 )
@@ -163,8 +195,8 @@ func init() {
 	log.Printf("Working days configured: %v", workingWeekdays)
 }
 
-func generateAvailableSlotsDirect() map[string][]string {
-	slots := make(map[string][]string)
+func generateAvailableSlotsDirect(meetingType MeetingType, duration time.Duration) map[string][]Slot {
+	slots := make(map[string][]Slot)
 	now := time.Now()
 	var datesToCheck []string
 
@@ -173,16 +205,13 @@ func generateAvailableSlotsDirect() map[string][]string {
 		date := now.AddDate(0, 0, i)
 		dateStr := date.Format("2006-01-02")
 
-		// Check if current weekday is in working days
-		isWorkingDay := false
-		for _, workday := range workingWeekdays {
-			if date.Weekday() == workday {
-				isWorkingDay = true
-				break
-			}
+		// Working days only apply to static working hours
+		if AvailabilityMode == "hours" && !isWorkingDay(date) {
+			continue
 		}
 
-		if !isWorkingDay {
+		// Holidays close the whole day
+		if isHoliday(date) {
 			continue
 		}
 		datesToCheck = append(datesToCheck, dateStr)
@@ -195,61 +224,57 @@ func generateAvailableSlotsDirect() map[string][]string {
 	for _, dateStr := range datesToCheck {
 		// Check events cache
 		eventsCacheMutex.RLock()
-		events := eventsCache[dateStr]
+		day := eventsCache[dateStr]
 		eventsCacheMutex.RUnlock()
 
-		// Working hours
-		var daySlots []string
-		for hour := WorkDayStartHour; hour < WorkDayEndHour; hour++ {
-			timeStr := fmt.Sprintf("%02d:00", hour)
-			datetime, err := time.Parse("2006-01-02 15:04", dateStr+" "+timeStr)
-			if err != nil {
-				continue
-			}
-
-			slotStart := datetime
-			slotEnd := datetime.Add(time.Hour)
-			slotFree := true
-
-			// Check events
-			for _, event := range events {
-				dtstart := event.Props.Get(ical.PropDateTimeStart)
-				if dtstart == nil {
-					continue
-				}
+		if daySlots := freeSlots(day, meetingType, duration); len(daySlots) > 0 {
+			slots[dateStr] = daySlots
+		}
+	}
 
-				eventTime, err := dtstart.DateTime(time.UTC)
-				if err != nil {
-					continue
-				}
+	return slots
+}
 
-				dtend := event.Props.Get(ical.PropDateTimeEnd)
-				if dtend == nil {
-					dtend = &ical.Prop{Value: eventTime.Add(time.Hour).Format("20060102T150405Z")}
-				}
+// freeSlots returns start times, every SLOT_STEP minutes from the start of
+// a window, at which a meeting of the duration fits in the window and does
+// not overlap busy time. A group session of the meeting type at exactly
+// that time does not count as busy while it has seats left.
+func freeSlots(day DayEvents, meetingType MeetingType, duration time.Duration) []Slot {
+	step := time.Duration(SlotStep) * time.Minute
+
+	var daySlots []Slot
+	for _, window := range day.Windows {
+		for start := window.Start; !start.Add(duration).After(window.End); start = start.Add(step) {
+			slot := Interval{Start: start, End: start.Add(duration)}
+			slotFree := true
+			seatsLeft := meetingType.Seats
 
-				endTime, err := dtend.DateTime(time.UTC)
-				if err != nil {
+			// Check busy time
+			for _, interval := range day.Busy {
+				if !interval.Overlaps(slot) {
 					continue
 				}
-
-				if eventTime.Before(slotEnd) && endTime.After(slotStart) {
-					slotFree = false
-					break
+				if meetingType.Seats > 1 && isGroupUID(interval.UID, meetingType.ID, start) &&
+					interval.Start.Equal(slot.Start) && interval.End.Equal(slot.End) {
+					seatsLeft = meetingType.Seats - interval.Attendees
+					if seatsLeft > 0 {
+						continue
+					}
 				}
+				slotFree = false
+				break
 			}
 
 			if slotFree {
-				daySlots = append(daySlots, timeStr)
+				s := Slot{Time: start.UTC().Format("15:04")}
+				if meetingType.Seats > 1 {
+					s.SeatsLeft = seatsLeft
+				}
+				daySlots = append(daySlots, s)
 			}
 		}
-
-		if len(daySlots) > 0 {
-			slots[dateStr] = daySlots
-		}
 	}
-
-	return slots
+	return daySlots
 }
 
 func rateLimit(next http.Handler) http.Handler {
@@ -262,46 +287,31 @@ func rateLimit(next http.Handler) http.Handler {
 	})
 }
 
-func initCalDAVClient() {
-	httpClient := &http.Client{
-		Transport: &basicAuthTransport{
-			Username: caldavConfig.Username,
-			Password: caldavConfig.Password,
-			Base:     http.DefaultTransport,
-		},
-		Timeout: 10 * time.Second,
-	}
-
-	var err error
-	caldavClient, err = caldav.NewClient(httpClient, caldavConfig.ServerURL)
-	if err != nil {
-		log.Fatalf("Error initializing CalDAV client: %v", err)
-	}
-
-	// Verify calendar availability
-	ctx := context.Background()
-	_, err = caldavClient.FindCalendars(ctx, "")
-	if err != nil {
-		log.Fatalf("Error accessing calendar: %v", err)
-	}
-
-	log.Println("CalDAV client successfully initialized and connected")
-}
-
-type basicAuthTransport struct {
-	Username string
-	Password string
-	Base     http.RoundTripper
-}
-
-func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.SetBasicAuth(t.Username, t.Password)
-	return t.Base.RoundTrip(req)
-}
-
 func main() {
-	// Initialize CalDAV client
-	initCalDAVClient()
+	demo := flag.Bool("demo", false, "Run with an embedded CalDAV server holding sample events")
+	flag.Parse()
+
+	if *demo {
+		startDemoServer()
+	}
+
+	// Initialize calendar backend
+	initBackend()
+	initAvailability()
+	initCalendarSources()
+	initICSSources()
+	initHolidayCalendars()
+	initMeetingTypes()
+	initBookingLinks()
+	initAuditLog()
+	initTemplates()
+	initNotifiers()
+	initWebhooks()
+	initInvitations()
+	initContactChannels()
+	initBookings()
+	initReconciliation()
+	initReminders()
 
 	r := mux.NewRouter()
 	r.Use(rateLimit)
@@ -318,9 +328,15 @@ func main() {
 	}).Methods("GET")
 
 	// API endpoints
-	r.HandleFunc("/api/available", availableSlots).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/meeting-types", meetingTypesHandler).Methods("GET")
+	r.HandleFunc("/api/form-schema", formSchema).Methods("GET")
+	r.HandleFunc("/api/available", availableSlots(false)).Methods("GET", "OPTIONS")
+	r.HandleFunc("/api/v2/available", availableSlots(true)).Methods("GET", "OPTIONS")
 	r.HandleFunc("/api/booking", bookingSlot).Methods("POST", "OPTIONS")
 	r.HandleFunc("/api/cancel", cancelSlot).Methods("POST", "OPTIONS")
+	r.HandleFunc("/api/reschedule", rescheduleSlot).Methods("POST", "OPTIONS")
+	registerManageRoutes(r)
+	registerAdminRoutes(r)
 
 	// Main page
 	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
@@ -331,82 +347,65 @@ func main() {
 	log.Fatal(http.ListenAndServe("0.0.0.0:5000", r))
 }
 
-func availableSlots(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-	w.Header().Set("Access-Control-Allow-Credentials", "true")
-
-	// Handle preflight requests
-	if r.Method == "OPTIONS" {
-		return
-	}
-
-	// Generate slots directly
-	slots := generateAvailableSlotsDirect()
-
-	if err := json.NewEncoder(w).Encode(slots); err != nil {
-		log.Printf("JSON encoding error: %v", err)
-		http.Error(w, "Server error", http.StatusInternalServerError)
-		return
-	}
-}
-
-// parseRRule parses RRULE string into RRule struct
-func parseRRule(rruleStr string) (*RRule, error) {
-	if rruleStr == "" {
-		return nil, nil
-	}
-
-	rrule := &RRule{
-		Interval: 1, // Default interval
-	}
-
-	// Remove RRULE: prefix if present
-	rruleStr = strings.TrimPrefix(rruleStr, "RRULE:")
+// availableSlots serves the free slots by date. The original format lists
+// start times only; with detailed, the v2 format, each slot is an object
+// that also carries the free seats of a group session.
+func availableSlots(detailed bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
 
-	// Split by semicolon
-	parts := strings.Split(rruleStr, ";")
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
 
-	for _, part := range parts {
-		keyValue := strings.Split(part, "=")
-		if len(keyValue) != 2 {
-			continue
+		// Slots depend on the requested meeting type and duration
+		minutes, _ := strconv.Atoi(r.URL.Query().Get("duration"))
+		meetingType, duration, err := resolveDuration(r.URL.Query().Get("type"), minutes)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		key := strings.TrimSpace(keyValue[0])
-		value := strings.TrimSpace(keyValue[1])
+		// Generate slots directly
+		slots := generateAvailableSlotsDirect(meetingType, duration)
 
-		switch key {
-		case "FREQ":
-			rrule.Freq = value
-		case "INTERVAL":
-			if interval, err := strconv.Atoi(value); err == nil {
-				rrule.Interval = interval
-			}
-		case "COUNT":
-			if count, err := strconv.Atoi(value); err == nil {
-				rrule.Count = count
-			}
-		case "UNTIL":
-			// Parse UNTIL date (format: 20231231T235959Z)
-			if until, err := time.Parse("20060102T150405Z", value); err == nil {
-				rrule.Until = until
-			} else if until, err := time.Parse("20060102", value); err == nil {
-				rrule.Until = until
-			}
-		case "BYDAY":
-			rrule.ByDay = strings.Split(value, ",")
+		var body any = slots
+		if !detailed {
+			body = slotTimes(slots)
+		}
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			log.Printf("JSON encoding error: %v", err)
+			http.Error(w, "Server error", http.StatusInternalServerError)
+			return
 		}
 	}
+}
 
-	return rrule, nil
+// slotTimes reduces slots to their start times, the format of /api/available
+func slotTimes(slots map[string][]Slot) map[string][]string {
+	times := make(map[string][]string, len(slots))
+	for date, daySlots := range slots {
+		times[date] = make([]string, 0, len(daySlots))
+		for _, slot := range daySlots {
+			times[date] = append(times[date], slot.Time)
+		}
+	}
+	return times
 }
 
-// expandRecurringEvent generates recurring event instances for a given date range
-func expandRecurringEvent(event *ical.Component, startDate, endDate time.Time) []*ical.Component {
-	var expandedEvents []*ical.Component
+// maxRecurrenceInstances limits how many instances of a recurring event
+// are generated from its DTSTART
+const maxRecurrenceInstances = 20000
 
+// expandRecurringEvent returns the instances of an event overlapping the
+// date range. RRULE, RDATE and EXDATE are expanded in the time zone of
+// DTSTART, so instances keep their local time across DST changes. Instances
+// in skip, replaced by components with a RECURRENCE-ID, are left out.
+func expandRecurringEvent(event *ical.Component, startDate, endDate time.Time, skip []time.Time) []*ical.Component {
 	// Get event start time
 	dtstart := event.Props.Get(ical.PropDateTimeStart)
 	if dtstart == nil {
@@ -419,232 +418,167 @@ func expandRecurringEvent(event *ical.Component, startDate, endDate time.Time) [
 	}
 
 	// Get event duration
-	dtend := event.Props.Get(ical.PropDateTimeEnd)
-	var duration time.Duration = time.Hour // Default 1 hour
-	if dtend != nil {
-		if eventEnd, err := dtend.DateTime(time.UTC); err == nil {
-			duration = eventEnd.Sub(eventStart)
-		}
-	}
+	duration := eventDuration(event, eventStart)
 
-	// Check for RRULE
-	rruleProp := event.Props.Get(ical.PropRecurrenceRule)
-	if rruleProp == nil {
-		// No recurrence rule, return original event if it falls within date range
-		if (eventStart.After(startDate) || eventStart.Equal(startDate)) && eventStart.Before(endDate) {
+	set, err := recurrenceSet(event, eventStart)
+	if err != nil {
+		uid, _ := event.Props.Text(ical.PropUID)
+		log.Printf("Ignoring invalid recurrence of %s: %v", uid, err)
+	}
+	if set == nil {
+		// No recurrence, return original event if it overlaps date range
+		if eventStart.Before(endDate) && eventStart.Add(duration).After(startDate) {
 			return []*ical.Component{event}
 		}
 		return nil
 	}
-
-	rrule, err := parseRRule(rruleProp.Value)
-	if err != nil || rrule == nil {
-		return []*ical.Component{event}
+	for _, t := range skip {
+		set.ExDate(t)
 	}
 
-	// Generate recurring instances
-	current := eventStart
-	count := 0
-	maxIterations := 1000 // Safety limit
-
-	for i := 0; i < maxIterations; i++ {
-		// Check if we've exceeded the count limit
-		if rrule.Count > 0 && count >= rrule.Count {
+	// Only instances starting after startDate-duration reach into the range.
+	// Instances are walked from DTSTART, so the walk is capped for rules in
+	// external calendars that never reach the range.
+	var instances []*ical.Component
+	after := startDate.Add(-duration)
+	next := set.Iterator()
+	for i := 0; ; i++ {
+		if i == maxRecurrenceInstances {
+			uid, _ := event.Props.Text(ical.PropUID)
+			log.Printf("Stopped expanding %s after %d instances", uid, maxRecurrenceInstances)
 			break
 		}
-
-		// Check if we've exceeded the until date
-		if !rrule.Until.IsZero() && current.After(rrule.Until) {
+		start, ok := next()
+		if !ok || !start.Before(endDate) {
 			break
 		}
-
-		// Check if current date is beyond our search range
-		if current.After(endDate) {
-			break
+		if !start.After(after) {
+			continue
 		}
 
-		// If current date is within our range, create an event instance
-		if (current.After(startDate) || current.Equal(startDate)) && current.Before(endDate) {
-			// Create a copy of the original event with new date/time
-			eventCopy := &ical.Component{
-				Name:     event.Name,
-				Props:    make(ical.Props),
-				Children: event.Children,
-			}
+		instance := &ical.Component{
+			Name:     event.Name,
+			Props:    make(ical.Props),
+			Children: event.Children,
+		}
+		for key, props := range event.Props {
+			instance.Props[key] = append([]ical.Prop(nil), props...)
+		}
+		instance.Props.SetDateTime(ical.PropDateTimeStart, start.UTC())
+		instance.Props.SetDateTime(ical.PropDateTimeEnd, start.Add(duration).UTC())
 
-			// Copy all properties
-			for key, props := range event.Props {
-				eventCopy.Props[key] = make([]ical.Prop, len(props))
-				for i, prop := range props {
-					eventCopy.Props[key][i] = prop
-				}
-			}
+		instances = append(instances, instance)
+	}
+	return instances
+}
 
-			// Update start and end times
-			eventCopy.Props.SetDateTime(ical.PropDateTimeStart, current.UTC())
-			eventCopy.Props.SetDateTime(ical.PropDateTimeEnd, current.Add(duration).UTC())
+// recurrenceSet builds the recurrence of an event from RRULE, RDATE and
+// EXDATE, or returns nil for a single event
+func recurrenceSet(event *ical.Component, eventStart time.Time) (*rrule.Set, error) {
+	ruleProp := event.Props.Get(ical.PropRecurrenceRule)
+	rdates := event.Props.Values(ical.PropRecurrenceDates)
+	if ruleProp == nil && len(rdates) == 0 {
+		return nil, nil
+	}
 
-			expandedEvents = append(expandedEvents, eventCopy)
-			count++
+	set := &rrule.Set{}
+	set.DTStart(eventStart)
+	if ruleProp != nil {
+		option, err := rrule.StrToROptionInLocation(ruleProp.Value, eventStart.Location())
+		if err != nil {
+			return nil, err
 		}
-
-		// Calculate next occurrence
-		switch rrule.Freq {
-		case "DAILY":
-			current = current.AddDate(0, 0, rrule.Interval)
-		case "WEEKLY":
-			if len(rrule.ByDay) > 0 {
-				// Handle BYDAY for weekly recurrence
-				current = getNextWeeklyOccurrence(current, rrule.ByDay, rrule.Interval)
-			} else {
-				current = current.AddDate(0, 0, 7*rrule.Interval)
-			}
-		case "MONTHLY":
-			current = current.AddDate(0, rrule.Interval, 0)
-		case "YEARLY":
-			current = current.AddDate(rrule.Interval, 0, 0)
-		default:
-			// Unknown frequency, break to avoid infinite loop
-			break
+		if option.Freq == rrule.MINUTELY || option.Freq == rrule.SECONDLY {
+			return nil, fmt.Errorf("frequency %s is not supported", option.Freq)
 		}
-
-		// Safety check: if we haven't advanced time, break
-		if i > 0 && !current.After(eventStart.AddDate(0, 0, i)) {
-			break
+		option.Dtstart = eventStart
+		rule, err := rrule.NewRRule(*option)
+		if err != nil {
+			return nil, err
 		}
+		set.RRule(rule)
+	} else {
+		// DTSTART is the first instance, RDATE adds the others
+		set.RDate(eventStart)
 	}
 
-	return expandedEvents
+	for _, prop := range rdates {
+		for _, t := range propDateTimes(prop) {
+			set.RDate(t)
+		}
+	}
+	for _, prop := range event.Props.Values(ical.PropExceptionDates) {
+		for _, t := range propDateTimes(prop) {
+			set.ExDate(t)
+		}
+	}
+	return set, nil
 }
 
-// getNextWeeklyOccurrence calculates next weekly occurrence based on BYDAY
-func getNextWeeklyOccurrence(current time.Time, byDay []string, interval int) time.Time {
-	// Map day abbreviations to weekday
-	dayMap := map[string]time.Weekday{
-		"SU": time.Sunday,
-		"MO": time.Monday,
-		"TU": time.Tuesday,
-		"WE": time.Wednesday,
-		"TH": time.Thursday,
-		"FR": time.Friday,
-		"SA": time.Saturday,
+// propDateTimes parses the comma-separated values of an RDATE or EXDATE,
+// honouring its TZID. PERIOD values are skipped.
+func propDateTimes(prop ical.Prop) []time.Time {
+	var times []time.Time
+	for _, value := range strings.Split(prop.Value, ",") {
+		single := prop
+		single.Value = strings.TrimSpace(value)
+		if t, err := single.DateTime(time.UTC); err == nil {
+			times = append(times, t)
+		}
 	}
+	return times
+}
 
-	// Convert BYDAY to weekdays
-	var targetDays []time.Weekday
-	for _, day := range byDay {
-		if wd, ok := dayMap[strings.ToUpper(day)]; ok {
-			targetDays = append(targetDays, wd)
+// eventDuration returns the event length from DTEND or DURATION. Events
+// without either last one hour, or one day for all-day events.
+func eventDuration(event *ical.Component, eventStart time.Time) time.Duration {
+	if dtend := event.Props.Get(ical.PropDateTimeEnd); dtend != nil {
+		if eventEnd, err := dtend.DateTime(time.UTC); err == nil {
+			return eventEnd.Sub(eventStart)
 		}
 	}
 
-	if len(targetDays) == 0 {
-		// No valid days, fall back to weekly interval
-		return current.AddDate(0, 0, 7*interval)
+	if prop := event.Props.Get(ical.PropDuration); prop != nil {
+		if duration, err := prop.Duration(); err == nil {
+			return duration
+		}
 	}
 
-	// Find next occurrence
-	next := current.AddDate(0, 0, 1) // Start from next day
-	for i := 0; i < 7*interval; i++ {
-		for _, targetDay := range targetDays {
-			if next.Weekday() == targetDay {
-				return next
-			}
-		}
-		next = next.AddDate(0, 0, 1)
+	if isAllDayEvent(event) {
+		return 24 * time.Hour
 	}
 
-	// Fallback
-	return current.AddDate(0, 0, 7*interval)
+	return time.Hour // Default 1 hour
+}
+
+// DayEvents holds what is known about a single day
+type DayEvents struct {
+	Busy    []Interval // Busy time from all calendars
+	Windows []Interval // Bookable windows, sorted
 }
 
-func loadEventsForDate(date string) ([]*ical.Component, error) {
+func loadEventsForDate(date string) (DayEvents, error) {
 	// Parse date
 	day, err := time.Parse("2006-01-02", date)
 	if err != nil {
-		return nil, err
+		return DayEvents{}, err
 	}
 
 	startOfDay := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
 	endOfDay := startOfDay.Add(24 * time.Hour)
-
-	// Load all events from a wider range to catch recurring events
-	// that might start before our target date but recur on it
-	searchStart := startOfDay.AddDate(-1, 0, 0) // 1 year back
-	searchEnd := endOfDay.AddDate(1, 0, 0)      // 1 year forward
-
-	query := &caldav.CalendarQuery{
-		CompFilter: caldav.CompFilter{
-			Name: "VCALENDAR",
-			Comps: []caldav.CompFilter{{
-				Name:  "VEVENT",
-				Start: searchStart,
-				End:   searchEnd,
-			}},
-		},
-	}
-
-	var allRawEvents []*ical.Component
-	calendarsToCheck := append([]string{caldavConfig.Calendar}, caldavConfig.AdditionalCalendars...)
-
-	// Use WaitGroup for parallel calendar processing
-	var wg sync.WaitGroup
-	eventsChan := make(chan []*ical.Component, len(calendarsToCheck))
-	errChan := make(chan error, len(calendarsToCheck))
 	ctx := context.Background()
 
-	for _, calendar := range calendarsToCheck {
-		wg.Add(1)
-		go func(cal string) {
-			defer wg.Done()
-
-			calendarObjects, err := caldavClient.QueryCalendar(ctx, cal, query)
-			if err != nil {
-				log.Printf("Error querying calendar %s: %v", cal, err)
-				errChan <- err
-				return
-			}
-
-			var events []*ical.Component
-			for _, obj := range calendarObjects {
-				if obj.Data != nil {
-					for _, component := range obj.Data.Children {
-						if component.Name == ical.CompEvent {
-							events = append(events, component)
-						}
-					}
-				}
-			}
-			eventsChan <- events
-		}(calendar)
-	}
-
-	// Wait for all goroutines to complete
-	wg.Wait()
-	close(eventsChan)
-	close(errChan)
-
-	// Collect raw events
-	for events := range eventsChan {
-		allRawEvents = append(allRawEvents, events...)
-	}
-
-	// If failed to get any events at all, return error
-	if len(allRawEvents) == 0 && len(errChan) > 0 {
-		return nil, <-errChan
+	windows, err := availability.Windows(ctx, startOfDay, endOfDay)
+	if err != nil {
+		return DayEvents{}, err
 	}
 
-	// Now expand recurring events for our target date
-	var expandedEvents []*ical.Component
-	for _, event := range allRawEvents {
-		// Expand each event for our target day
-		instances := expandRecurringEvent(event, startOfDay, endOfDay)
-		expandedEvents = append(expandedEvents, instances...)
+	busy, err := listAllBusy(ctx, startOfDay, endOfDay)
+	if err != nil {
+		return DayEvents{}, err
 	}
 
-	//log.Printf("Loaded %d raw events, expanded to %d instances for date %s", len(allRawEvents), len(expandedEvents), date)
-
-	return expandedEvents, nil
+	return DayEvents{Busy: busy, Windows: windows}, nil
 }
 
 func syncEventsCache(dates []string) {
@@ -652,14 +586,14 @@ func syncEventsCache(dates []string) {
 	defer eventsCacheMutex.Unlock()
 
 	if eventsCache == nil {
-		eventsCache = make(map[string][]*ical.Component)
+		eventsCache = make(map[string]DayEvents)
 	}
 
 	// Use WaitGroup for parallel date processing
 	var wg sync.WaitGroup
 	results := make(chan struct {
 		date   string
-		events []*ical.Component
+		events DayEvents
 		err    error
 	}, len(dates))
 
@@ -670,7 +604,7 @@ func syncEventsCache(dates []string) {
 			events, err := loadEventsForDate(d)
 			results <- struct {
 				date   string
-				events []*ical.Component
+				events DayEvents
 				err    error
 			}{d, events, err}
 		}(date)
@@ -732,7 +666,7 @@ func bookingSlot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validation
-	if booking.Topic == "" || booking.FullName == "" || booking.ContactInfo == "" {
+	if booking.Topic == "" || booking.FullName == "" {
 		json.NewEncoder(w).Encode(BookingResponse{
 			Success: false,
 			Error:   "All fields are required",
@@ -740,12 +674,108 @@ func bookingSlot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	contacts, contactsError := checkContacts(booking.Contacts, booking.ContactInfo)
+	if contactsError != "" {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   contactsError,
+		})
+		return
+	}
+
+	meetingType, duration, err := resolveDuration(booking.MeetingType, booking.Duration)
+	if err != nil {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Invalid meeting type or duration",
+		})
+		return
+	}
+
+	guests, guestsError := parseGuests(booking.Guests, findContact(contacts, channelEmail), meetingType)
+	if guestsError != "" {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   guestsError,
+		})
+		return
+	}
+
+	answers, answersError := checkAnswers(meetingType, booking.Answers)
+	if answersError != "" {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   answersError,
+		})
+		return
+	}
+
+	phone := booking.Phone
+	if phone == "" {
+		phone = findContact(contacts, channelPhone)
+	}
+	location, videoURL, locationError := bookingLocation(meetingType, phone)
+	if locationError != "" {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   locationError,
+		})
+		return
+	}
+
+	// The slot may have been taken or closed since the list was loaded
+	bookingMutex.Lock()
+	defer bookingMutex.Unlock()
+	if !slotAvailable(booking.Date, booking.Time, meetingType, duration, "") {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Selected time is not available",
+		})
+		return
+	}
+
 	// Create event in CalDAV
-	code := uuid.New().String()[:8]
+	code := newBookingCode()
 	log.Printf("Creating booking with code: %s", code)
 
-	if err := createCalDAVEvent(booking, code); err != nil {
-		log.Printf("Error creating CalDAV event: %v", err)
+	start, _ := time.Parse("2006-01-02 15:04", booking.Date+" "+booking.Time)
+	uid := newEventUID()
+	record := &Booking{
+		Code:        code,
+		UID:         uid,
+		InviteUID:   uid,
+		Date:        booking.Date,
+		Time:        booking.Time,
+		MeetingType: meetingType.ID,
+		Duration:    int(duration.Minutes()),
+		Topic:       booking.Topic,
+		FullName:    booking.FullName,
+		ContactInfo: contactSummary(contacts),
+		Contacts:    contacts,
+		Timezone:    validTimezone(booking.Timezone),
+		Language:    normalizeLanguage(booking.Language),
+		Guests:      guests,
+		Location:    location,
+		VideoURL:    videoURL,
+		Answers:     answers,
+		CreatedAt:   time.Now(),
+	}
+
+	if meetingType.Seats > 1 {
+		record.Seat = true
+		record.UID, err = bookSeat(meetingType, start, duration, record)
+	} else {
+		err = createBookingEvent(record, duration)
+	}
+	if errors.Is(err, errSessionFull) {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Selected time is not available",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error creating booking event: %v", err)
 		json.NewEncoder(w).Encode(BookingResponse{
 			Success: false,
 			Error:   "Booking creation error: " + err.Error(),
@@ -754,16 +784,62 @@ func bookingSlot(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save cancellation code
-	eventId := fmt.Sprintf("%s-%s", booking.Date, booking.Time)
-	bookingCodes[code] = eventId
-	log.Printf("Booking successfully created with code: %s; EID %s", code, eventId)
+	saveBooking(record)
+	log.Printf("Booking successfully created with code: %s; UID %s", code, record.UID)
+	notify(Notification{Event: notifyConfirmed, Booking: *record})
+	notify(Notification{Event: notifyConfirmed, Owner: true, Booking: *record})
 
 	json.NewEncoder(w).Encode(BookingResponse{
-		Success: true,
-		Code:    code,
+		Success:   true,
+		Code:      code,
+		ManageURL: manageURL(code),
+		Location:  record.Location,
+		VideoURL:  record.VideoURL,
 	})
 }
 
+// slotAvailable checks a requested slot of the duration against the
+// booking range, holidays, availability windows and busy time. Busy time
+// of the event with ignoreUID, a booking being moved, is left out.
+func slotAvailable(date, slotTime string, meetingType MeetingType, duration time.Duration, ignoreUID string) bool {
+	start, err := time.Parse("2006-01-02 15:04", date+" "+slotTime)
+	if err != nil || start.Before(time.Now()) {
+		return false
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if !start.Before(today.AddDate(0, 0, DaysAvailableForBooking)) {
+		return false
+	}
+
+	if isHoliday(start) {
+		return false
+	}
+
+	day, err := loadEventsForDate(date)
+	if err != nil {
+		log.Printf("Error loading events for date %s: %v", date, err)
+		return false
+	}
+
+	if ignoreUID != "" {
+		var busy []Interval
+		for _, interval := range day.Busy {
+			if interval.UID != ignoreUID {
+				busy = append(busy, interval)
+			}
+		}
+		day.Busy = busy
+	}
+
+	for _, slot := range freeSlots(day, meetingType, duration) {
+		if slot.Time == slotTime {
+			return true
+		}
+	}
+	return false
+}
+
 func cancelSlot(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
@@ -811,7 +887,15 @@ func cancelSlot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	eventId, exists := bookingCodes[cancel.Code]
+	record, exists, locked := checkCodeAttempt(r, cancel.Code, "cancel")
+	if locked {
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Too many attempts, try again later",
+		})
+		return
+	}
 	if !exists {
 		json.NewEncoder(w).Encode(BookingResponse{
 			Success: false,
@@ -820,155 +904,308 @@ func cancelSlot(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete event from CalDAV
-	if err := deleteCalDAVEvent(eventId); err != nil {
+	if message := cancelNoticeError(record); message != "" {
 		json.NewEncoder(w).Encode(BookingResponse{
 			Success: false,
-			Error:   "Cancellation error",
+			Error:   message,
 		})
 		return
 	}
 
-	delete(bookingCodes, cancel.Code)
+	// Delete event or seat from calendar
+	log.Printf("Cancelling booking with code: %s; UID %s", record.Code, record.UID)
+	if err := cancelBooking(record, cancel.Reason); err != nil {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Cancellation error",
+		})
+		return
+	}
 
 	json.NewEncoder(w).Encode(BookingResponse{
 		Success: true,
 	})
 }
 
-func createCalDAVEvent(booking BookingRequest, code string) error {
-	// Parse date and time
-	datetime, err := time.Parse("2006-01-02 15:04", booking.Date+" "+booking.Time)
-	if err != nil {
-		log.Printf("Error parsing date/time: %v", err)
-		return fmt.Errorf("invalid date or time format")
-	}
+func rescheduleSlot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-CSRF-Token")
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
 
-	log.Printf("Creating event: %s %s for %s", booking.Date, booking.Time, booking.FullName)
+	// Handle preflight requests
+	if r.Method == "OPTIONS" {
+		return
+	}
 
-	// If CalDAV client is unavailable, return error
-	if caldavClient == nil {
-		return fmt.Errorf("CalDAV client unavailable")
+	// Verify CSRF token
+	clientToken := r.Header.Get("X-CSRF-Token")
+	if clientToken == "" {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "CSRF token missing",
+		})
+		return
 	}
 
-	// Get calendar list to determine correct path
-	ctx := context.Background()
-	calendars, err := caldavClient.FindCalendars(ctx, "")
-	if err != nil {
-		log.Printf("Error getting calendars: %v", err)
-		return nil
+	var reschedule RescheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&reschedule); err != nil {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Invalid data format",
+		})
+		return
 	}
 
-	var calendarPath string
-	for _, cal := range calendars {
-		log.Printf("Found calendar: %s", cal.Path)
-		if strings.Contains(cal.Path, "default") || len(calendars) == 1 {
-			calendarPath = cal.Path
-			break
-		}
+	// Verify CSRF token matches
+	if reschedule.CSRFToken != clientToken {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Invalid CSRF token",
+		})
+		return
 	}
 
-	if calendarPath == "" && len(calendars) > 0 {
-		calendarPath = calendars[0].Path
+	record, exists, locked := checkCodeAttempt(r, reschedule.Code, "reschedule")
+	if locked {
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Too many attempts, try again later",
+		})
+		return
+	}
+	if !exists {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Invalid booking code",
+		})
+		return
 	}
 
-	if calendarPath == "" {
-		log.Println("No suitable calendar found")
-		return nil
+	if message := rescheduleNoticeError(record); message != "" {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   message,
+		})
+		return
 	}
 
-	log.Printf("Using calendar: %s", calendarPath)
+	if err := rescheduleBooking(record, reschedule.Date, reschedule.Time); err != nil {
+		json.NewEncoder(w).Encode(BookingResponse{
+			Success: false,
+			Error:   "Reschedule error: " + err.Error(),
+		})
+		return
+	}
 
-	// Create iCal event
-	cal := ical.NewCalendar()
-	cal.Props.SetText(ical.PropVersion, "2.0")
-	cal.Props.SetText(ical.PropProductID, "-//Book my meet//EN")
+	json.NewEncoder(w).Encode(BookingResponse{
+		Success: true,
+		Code:    record.Code,
+	})
+}
 
-	event := ical.NewEvent()
-	event.Props.SetText(ical.PropUID, code+"@BookMyMeet")
-	event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
-	event.Props.SetDateTime(ical.PropDateTimeStart, datetime.UTC())
-	event.Props.SetDateTime(ical.PropDateTimeEnd, datetime.Add(time.Hour).UTC())
-	event.Props.SetText(ical.PropSummary, booking.Topic)
+// rescheduleBooking moves a booking to a new slot of the same meeting type
+// and duration. The old slot is only released once the move succeeded.
+func rescheduleBooking(record *Booking, date, slotTime string) error {
+	meetingType, duration, err := resolveDuration(record.MeetingType, record.Duration)
+	if err != nil {
+		return fmt.Errorf("meeting type is no longer offered")
+	}
 
-	description := fmt.Sprintf("Who are you?: %s\nContact method: %s\nCancellation code: %s",
-		booking.FullName, booking.ContactInfo, code)
-	event.Props.SetText(ical.PropDescription, description)
-	event.Props.SetText(ical.PropStatus, "CONFIRMED")
+	start, err := time.Parse("2006-01-02 15:04", date+" "+slotTime)
+	if err != nil {
+		return fmt.Errorf("invalid date or time format")
+	}
+	if date == record.Date && slotTime == record.Time {
+		return fmt.Errorf("booking is already at this time")
+	}
 
-	cal.Children = append(cal.Children, event.Component)
+	// A single booking may move within its own time, a seat joins another session
+	ignoreUID := record.UID
+	if record.Seat {
+		ignoreUID = ""
+	}
+	bookingMutex.Lock()
+	defer bookingMutex.Unlock()
+	if !slotAvailable(date, slotTime, meetingType, duration, ignoreUID) {
+		return fmt.Errorf("selected time is not available")
+	}
 
-	// Create CalDAV event with correct path
-	eventPath := calendarPath + code + ".ics"
-	log.Printf("Attempting to create event at path: %s", eventPath)
+	log.Printf("Rescheduling booking %s to %s %s", record.Code, date, slotTime)
 
-	_, err = caldavClient.PutCalendarObject(ctx, eventPath, cal)
-	if err != nil {
-		log.Printf("Error creating CalDAV event: %v", err)
-		log.Println("Event saved locally but not synced with CalDAV")
-		return nil
+	// The stored record is shared, the move is built on a copy
+	moved := *record
+	if record.Seat {
+		// The other session has a room of its own
+		seat := *record
+		seat.Location, seat.VideoURL, _ = bookingLocation(meetingType, "")
+		uid, err := bookSeat(meetingType, start, duration, &seat)
+		if err != nil {
+			log.Printf("Error booking new seat: %v", err)
+			return fmt.Errorf("selected time is not available")
+		}
+		if err := cancelSeat(record); err != nil {
+			log.Printf("Error releasing old seat of %s: %v", record.Code, err)
+		}
+		moved.UID, moved.Location, moved.VideoURL = uid, seat.Location, seat.VideoURL
+	} else if err := moveBookingEvent(record.UID, start, duration); err != nil {
+		log.Printf("Error moving booking event: %v", err)
+		return fmt.Errorf("could not update the calendar")
 	}
 
-	log.Printf("Event successfully created in CalDAV with UID: %s", code)
+	moved.Date, moved.Time = date, slotTime
+	moved.Sequence++
+	moved.RemindersSent = nil
+	saveBooking(&moved)
+
+	notify(Notification{Event: notifyRescheduled, Booking: moved})
+	notify(Notification{Event: notifyRescheduled, Owner: true, Booking: moved})
 	return nil
 }
 
-func deleteCalDAVEvent(eventId string) error {
-	log.Printf("Deleting CalDAV event: %s", eventId)
-
-	// If CalDAV client is unavailable, return error
-	if caldavClient == nil {
-		return fmt.Errorf("CalDAV client unavailable")
+func createBookingEvent(record *Booking, duration time.Duration) error {
+	// Parse date and time
+	datetime, err := time.Parse("2006-01-02 15:04", record.Date+" "+record.Time)
+	if err != nil {
+		log.Printf("Error parsing date/time: %v", err)
+		return fmt.Errorf("invalid date or time format")
 	}
 
-	// Find event code by eventId
-	var code string
-	for c, eid := range bookingCodes {
-		if eid == eventId {
-			code = c
-			break
-		}
+	summary, description, err := eventTexts(*record)
+	if err != nil {
+		log.Printf("Error rendering event texts: %v", err)
+		return fmt.Errorf("could not render the event")
 	}
 
-	if code == "" {
-		return fmt.Errorf("no code found for event: %s", eventId)
+	log.Printf("Creating event: %s %s for %s", record.Date, record.Time, record.FullName)
+
+	// Create iCal event
+	cal, event := newEventCalendar(record.UID, datetime, duration, summary)
+	event.Props.SetText(ical.PropDescription, description)
+	setEventLocation(event, record.Location, record.VideoURL)
+	setAnswerProps(event, record)
+	setContactProps(event, record)
+	record.Invited = setBookingAttendee(event, record)
+
+	if err := backend.CreateEvent(context.Background(), cal); err != nil {
+		return err
 	}
 
-	// Get correct calendar path
+	log.Printf("Event successfully created with UID: %s", record.UID)
+	return nil
+}
+
+// updateBookingDescription rewrites the event description and attendee
+// from the booking
+func updateBookingDescription(record *Booking) error {
 	ctx := context.Background()
-	calendars, err := caldavClient.FindCalendars(ctx, "")
+
+	cal, err := backend.FindByUID(ctx, record.UID)
 	if err != nil {
-		log.Printf("Error getting calendars for deletion: %v", err)
-		return nil
+		return err
+	}
+	event := calendarEvent(cal)
+	if event == nil {
+		return fmt.Errorf("calendar object %s has no event", record.UID)
 	}
 
-	var calendarPath string
-	for _, cal := range calendars {
-		if strings.Contains(cal.Path, "default") || len(calendars) == 1 {
-			calendarPath = cal.Path
-			break
-		}
+	summary, description, err := eventTexts(*record)
+	if err != nil {
+		return err
 	}
+	event.Props.SetText(ical.PropSummary, summary)
+	event.Props.SetText(ical.PropDescription, description)
+	setContactProps(event, record)
+	record.Invited = setBookingAttendee(event, record)
+	event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+
+	return backend.UpdateEvent(ctx, cal)
+}
 
-	if calendarPath == "" && len(calendars) > 0 {
-		calendarPath = calendars[0].Path
+// moveBookingEvent updates the event in place with new times and an
+// incremented SEQUENCE so calendar clients pick up the change
+func moveBookingEvent(uid string, start time.Time, duration time.Duration) error {
+	ctx := context.Background()
+
+	cal, err := backend.FindByUID(ctx, uid)
+	if err != nil {
+		return err
+	}
+	event := calendarEvent(cal)
+	if event == nil {
+		return fmt.Errorf("calendar object %s has no event", uid)
 	}
 
-	if calendarPath == "" {
-		log.Println("No calendar found for deletion")
-		return nil
+	event.Props.SetDateTime(ical.PropDateTimeStart, start.UTC())
+	event.Props.SetDateTime(ical.PropDateTimeEnd, start.Add(duration).UTC())
+	event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	event.Props.Del(ical.PropDuration)
+	incrementSequence(event)
+
+	return backend.UpdateEvent(ctx, cal)
+}
+
+// incrementSequence bumps the SEQUENCE of an event after a significant change
+func incrementSequence(event *ical.Component) {
+	setSequence(event, eventSequence(event)+1)
+}
+
+// eventSequence returns the SEQUENCE of an event, 0 if unset
+func eventSequence(event *ical.Component) int {
+	sequence := 0
+	if prop := event.Props.Get(ical.PropSequence); prop != nil {
+		sequence, _ = prop.Int()
 	}
+	return sequence
+}
 
-	// Delete event from CalDAV
-	eventPath := calendarPath + code + ".ics"
-	log.Printf("Attempting to delete event at path: %s", eventPath)
+func setSequence(event *ical.Component, sequence int) {
+	seq := ical.NewProp(ical.PropSequence)
+	seq.SetValueType(ical.ValueInt)
+	seq.Value = strconv.Itoa(sequence)
+	event.Props.Set(seq)
+}
 
-	err = caldavClient.RemoveAll(ctx, eventPath)
-	if err != nil {
-		log.Printf("Error deleting event from CalDAV: %v", err)
+// newEventCalendar builds a calendar object holding a single confirmed event
+func newEventCalendar(uid string, start time.Time, duration time.Duration, summary string) (*ical.Calendar, *ical.Component) {
+	cal := ical.NewCalendar()
+	cal.Props.SetText(ical.PropVersion, "2.0")
+	cal.Props.SetText(ical.PropProductID, "-//Book my meet//EN")
+
+	event := ical.NewEvent()
+	event.Props.SetText(ical.PropUID, uid)
+	event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	event.Props.SetDateTime(ical.PropDateTimeStart, start.UTC())
+	event.Props.SetDateTime(ical.PropDateTimeEnd, start.Add(duration).UTC())
+	event.Props.SetText(ical.PropSummary, summary)
+	event.Props.SetText(ical.PropStatus, "CONFIRMED")
+	addAlarms(event.Component, summary)
+
+	cal.Children = append(cal.Children, event.Component)
+	return cal, event.Component
+}
+
+func deleteBookingEvent(uid string) error {
+	log.Printf("Deleting booking event: %s", uid)
+
+	err := backend.DeleteEvent(context.Background(), uid)
+	if errors.Is(err, ErrEventNotFound) {
+		// Already removed from the calendar, nothing left to do
+		log.Printf("Event already missing: %s", uid)
 		return nil
 	}
+	if err != nil {
+		log.Printf("Error deleting booking event: %v", err)
+		return err
+	}
 
-	log.Printf("Event successfully deleted from CalDAV: %s", code)
+	log.Printf("Event successfully deleted: %s", uid)
 	return nil
 }
+
+// newEventUID returns a random event UID. UIDs end up in every copy of an
+// invitation, so they must not contain the cancellation code.
+func newEventUID() string {
+	return uuid.New().String() + "@BookMyMeet"
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// parseEvent decodes the first VEVENT of an iCalendar text
+func parseEvent(t *testing.T, text string) *ical.Component {
+	t.Helper()
+
+	text = strings.ReplaceAll(strings.TrimSpace(text), "\n", "\r\n") + "\r\n"
+	cal, err := ical.NewDecoder(strings.NewReader(text)).Decode()
+	if err != nil {
+		t.Fatalf("decoding calendar: %v", err)
+	}
+	events := cal.Events()
+	if len(events) == 0 {
+		t.Fatal("calendar has no event")
+	}
+	return events[0].Component
+}
+
+func eventCalendar(event string) string {
+	return "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:-//test//EN\n" + event + "\nEND:VCALENDAR"
+}
+
+func instanceStarts(t *testing.T, instances []*ical.Component) []string {
+	t.Helper()
+
+	var starts []string
+	for _, instance := range instances {
+		start, err := instance.Props.DateTime(ical.PropDateTimeStart, time.UTC)
+		if err != nil {
+			t.Fatalf("instance start: %v", err)
+		}
+		starts = append(starts, start.UTC().Format("2006-01-02 15:04"))
+	}
+	return starts
+}
+
+func TestExpandRecurringEvent(t *testing.T) {
+	tests := []struct {
+		name       string
+		event      string
+		start, end string
+		skip       []time.Time
+		want       []string
+	}{
+		{
+			name: "weekly rule started years ago",
+			event: `BEGIN:VEVENT
+UID:weekly
+DTSTAMP:20200101T000000Z
+DTSTART:20200106T090000Z
+DTEND:20200106T100000Z
+RRULE:FREQ=WEEKLY;BYDAY=MO
+END:VEVENT`,
+			start: "2026-10-05 00:00",
+			end:   "2026-10-20 00:00",
+			want:  []string{"2026-10-05 09:00", "2026-10-12 09:00", "2026-10-19 09:00"},
+		},
+		{
+			name: "exdate list",
+			event: `BEGIN:VEVENT
+UID:exdate
+DTSTAMP:20260101T000000Z
+DTSTART:20261001T090000Z
+DTEND:20261001T100000Z
+RRULE:FREQ=DAILY
+EXDATE:20261002T090000Z,20261004T090000Z
+END:VEVENT`,
+			start: "2026-10-01 00:00",
+			end:   "2026-10-06 00:00",
+			want:  []string{"2026-10-01 09:00", "2026-10-03 09:00", "2026-10-05 09:00"},
+		},
+		{
+			name: "rdate without rule",
+			event: `BEGIN:VEVENT
+UID:rdate
+DTSTAMP:20260101T000000Z
+DTSTART:20261001T090000Z
+DTEND:20261001T100000Z
+RDATE:20261003T140000Z,20261009T140000Z
+END:VEVENT`,
+			start: "2026-10-01 00:00",
+			end:   "2026-10-05 00:00",
+			want:  []string{"2026-10-01 09:00", "2026-10-03 14:00"},
+		},
+		{
+			name: "instance started before the range",
+			event: `BEGIN:VEVENT
+UID:overlap
+DTSTAMP:20260101T000000Z
+DTSTART:20261001T220000Z
+DTEND:20261002T020000Z
+RRULE:FREQ=DAILY;COUNT=3
+END:VEVENT`,
+			start: "2026-10-02 00:00",
+			end:   "2026-10-03 00:00",
+			want:  []string{"2026-10-01 22:00", "2026-10-02 22:00"},
+		},
+		{
+			name: "instance replaced by a recurrence id",
+			event: `BEGIN:VEVENT
+UID:override
+DTSTAMP:20260101T000000Z
+DTSTART:20261001T090000Z
+DTEND:20261001T100000Z
+RRULE:FREQ=DAILY;COUNT=3
+END:VEVENT`,
+			start: "2026-10-01 00:00",
+			end:   "2026-10-05 00:00",
+			skip:  []time.Time{time.Date(2026, 10, 2, 9, 0, 0, 0, time.UTC)},
+			want:  []string{"2026-10-01 09:00", "2026-10-03 09:00"},
+		},
+		{
+			name: "local time kept across daylight saving",
+			event: `BEGIN:VEVENT
+UID:dst
+DTSTAMP:20260101T000000Z
+DTSTART;TZID=Europe/Berlin:20261019T100000
+DTEND;TZID=Europe/Berlin:20261019T110000
+RRULE:FREQ=WEEKLY
+END:VEVENT`,
+			start: "2026-10-19 00:00",
+			end:   "2026-10-27 00:00",
+			want:  []string{"2026-10-19 08:00", "2026-10-26 09:00"},
+		},
+		{
+			name: "secondly rule is not expanded",
+			event: `BEGIN:VEVENT
+UID:secondly
+DTSTAMP:20000101T000000Z
+DTSTART:20000101T000000Z
+DTEND:20000101T000001Z
+RRULE:FREQ=SECONDLY
+END:VEVENT`,
+			start: "2026-10-01 00:00",
+			end:   "2026-10-02 00:00",
+			want:  nil,
+		},
+		{
+			name: "expansion stops at the instance cap",
+			event: `BEGIN:VEVENT
+UID:capped
+DTSTAMP:20000101T000000Z
+DTSTART:20000101T000000Z
+DTEND:20000101T000001Z
+RRULE:FREQ=DAILY;BYHOUR=0,1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23;BYMINUTE=0,10,20,30,40,50
+END:VEVENT`,
+			start: "2026-10-01 00:00",
+			end:   "2026-10-02 00:00",
+			want:  nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := parseEvent(t, eventCalendar(test.event))
+			start, _ := time.Parse("2006-01-02 15:04", test.start)
+			end, _ := time.Parse("2006-01-02 15:04", test.end)
+
+			got := instanceStarts(t, expandRecurringEvent(event, start, end, test.skip))
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("instances = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
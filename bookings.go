@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Booking is what the server remembers about a booking, keyed by its
+// cancellation code
+type Booking struct {
+	Code          string    `json:"code"`
+	UID           string    `json:"uid"`                 // UID of the calendar event
+	InviteUID     string    `json:"inviteUid,omitempty"` // UID of the invitations, the event UID except for seats
+	Seat          bool      `json:"seat"`                // Seat in a group session rather than an event of its own
+	Date          string    `json:"date"`
+	Time          string    `json:"time"`
+	MeetingType   string    `json:"meetingType"`
+	Duration      int       `json:"duration"` // Minutes
+	Topic         string    `json:"topic"`
+	FullName      string    `json:"fullName"`
+	ContactInfo   string    `json:"contactInfo"`        // All contacts on one line
+	Contacts      []Contact `json:"contacts,omitempty"` // Contacts by channel
+	Timezone      string    `json:"timezone,omitempty"` // IANA timezone of the booker
+	Language      string    `json:"language,omitempty"` // Language tag of the booker
+	Sequence      int       `json:"sequence"`           // Revision of the invitation sent to the booker
+	Invited       bool      `json:"invited,omitempty"`  // The booker is an ATTENDEE asked to reply
+	Guests        []string  `json:"guests,omitempty"`   // Email addresses of people the booker brings along
+	Location      string    `json:"location,omitempty"` // LOCATION of the event: address, phone number or video link
+	VideoURL      string    `json:"videoUrl,omitempty"` // Link of a video meeting
+	Answers       []Answer  `json:"answers,omitempty"`  // Answers to the meeting type's questions
+	CreatedAt     time.Time `json:"createdAt"`
+	RemindersSent []string  `json:"remindersSent,omitempty"` // Reminder offsets already handled
+	Revision      int       `json:"revision"`                // Bumped on every save, guards replaceBooking
+}
+
+var BookingsFile = getEnvStr("BOOKINGS_FILE", "") // JSON file keeping bookings across restarts, memory only if unset
+
+var (
+	bookings      = make(map[string]*Booking) // In production use a database
+	bookingsMutex sync.RWMutex
+)
+
+// initBookings loads the bookings saved in BOOKINGS_FILE
+func initBookings() {
+	if BookingsFile == "" {
+		log.Printf("BOOKINGS_FILE is not set, bookings and pending reminders will not survive a restart")
+		return
+	}
+
+	data, err := os.ReadFile(BookingsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Error reading BOOKINGS_FILE: %v", err)
+	}
+	if err := json.Unmarshal(data, &bookings); err != nil {
+		log.Fatalf("Error parsing BOOKINGS_FILE: %v", err)
+	}
+	log.Printf("Loaded %d bookings from %s", len(bookings), BookingsFile)
+}
+
+// persistBookings writes the bookings to BOOKINGS_FILE. The caller holds
+// bookingsMutex.
+func persistBookings() {
+	if BookingsFile == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(bookings, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding bookings: %v", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(BookingsFile), ".bookings-*")
+	if err != nil {
+		log.Printf("Error saving bookings: %v", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		log.Printf("Error saving bookings: %v", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		log.Printf("Error saving bookings: %v", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), BookingsFile); err != nil {
+		log.Printf("Error saving bookings: %v", err)
+	}
+}
+
+func saveBooking(b *Booking) {
+	bookingsMutex.Lock()
+	defer bookingsMutex.Unlock()
+	storeBooking(b)
+}
+
+// storeBooking puts b in place of the stored booking with the next
+// revision. The caller holds bookingsMutex.
+func storeBooking(b *Booking) {
+	b.Revision = 1
+	if stored, exists := bookings[b.Code]; exists {
+		b.Revision = stored.Revision + 1
+	}
+	bookings[b.Code] = b
+	persistBookings()
+}
+
+func getBooking(code string) (*Booking, bool) {
+	bookingsMutex.RLock()
+	defer bookingsMutex.RUnlock()
+	b, exists := bookings[code]
+	return b, exists
+}
+
+// removeBooking forgets a booking and reports whether it was known
+func removeBooking(code string) bool {
+	bookingsMutex.Lock()
+	defer bookingsMutex.Unlock()
+
+	_, exists := bookings[code]
+	delete(bookings, code)
+	persistBookings()
+	return exists
+}
+
+// removeUnchangedBooking forgets a booking only if it is still at the
+// revision of b, and reports whether it did
+func removeUnchangedBooking(b Booking) bool {
+	bookingsMutex.Lock()
+	defer bookingsMutex.Unlock()
+
+	stored, exists := bookings[b.Code]
+	if !exists || stored.Revision != b.Revision {
+		return false
+	}
+	delete(bookings, b.Code)
+	persistBookings()
+	return true
+}
+
+// isCurrentBooking reports whether b is still the stored revision of its
+// booking
+func isCurrentBooking(b Booking) bool {
+	stored, exists := getBooking(b.Code)
+	return exists && stored.Revision == b.Revision
+}
+
+// getBookingByInviteUID finds the booking an invitation was sent for
+func getBookingByInviteUID(uid string) (*Booking, bool) {
+	bookingsMutex.RLock()
+	defer bookingsMutex.RUnlock()
+
+	for _, b := range bookings {
+		if b.inviteUID() == uid || (!b.Seat && b.UID == uid) {
+			return b, true
+		}
+	}
+	return nil, false
+}
+
+// inviteUID returns the UID of the invitations sent for a booking. It is
+// random rather than derived from the code, which guests must not learn.
+// Bookings stored before it was kept used the code.
+func (b Booking) inviteUID() string {
+	if b.InviteUID != "" {
+		return b.InviteUID
+	}
+	return b.Code + "@BookMyMeet"
+}
+
+// listBookings returns a copy of every stored booking
+func listBookings() []Booking {
+	bookingsMutex.RLock()
+	defer bookingsMutex.RUnlock()
+
+	list := make([]Booking, 0, len(bookings))
+	for _, b := range bookings {
+		list = append(list, *b)
+	}
+	return list
+}
+
+// replaceBooking stores b, a modified copy of a stored booking, only if
+// the booking is still at the revision it was copied from. A booking
+// cancelled, moved or edited meanwhile is neither brought back nor
+// overwritten with older state.
+func replaceBooking(b *Booking) bool {
+	bookingsMutex.Lock()
+	defer bookingsMutex.Unlock()
+
+	stored, exists := bookings[b.Code]
+	if !exists || stored.Revision != b.Revision {
+		return false
+	}
+	storeBooking(b)
+	return true
+}
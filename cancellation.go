@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+var (
+	CancelMinNotice = time.Duration(getEnvInt("CANCEL_MIN_NOTICE_HOURS", 0)) * time.Hour // No self-service cancellation closer to the meeting
+	CancelKeepEvent = getEnvStr("CANCEL_KEEP_EVENT", "false") == "true"                  // Keep cancelled events with STATUS:CANCELLED
+	OwnerContact    = getEnvStr("OWNER_CONTACT", "")                                     // How to reach the owner when self-service is closed
+)
+
+// maxCancelReason limits the length of a cancellation reason in runes
+const maxCancelReason = 500
+
+// cancelNoticeError returns why the booking can no longer be cancelled
+// online, or an empty string if it can
+func cancelNoticeError(record *Booking) string {
+	return noticeError(record, "cancelled")
+}
+
+// rescheduleNoticeError applies the same notice to moves, since a booking
+// moved away from an imminent slot could then be cancelled freely
+func rescheduleNoticeError(record *Booking) string {
+	return noticeError(record, "moved")
+}
+
+func noticeError(record *Booking, action string) string {
+	if CancelMinNotice <= 0 {
+		return ""
+	}
+
+	start, err := time.Parse("2006-01-02 15:04", record.Date+" "+record.Time)
+	if err != nil || time.Until(start) >= CancelMinNotice {
+		return ""
+	}
+
+	message := fmt.Sprintf("Bookings cannot be %s online less than %d hours before the meeting. Please contact the organizer",
+		action, int(CancelMinNotice.Hours()))
+	if OwnerContact != "" {
+		message += ": " + OwnerContact
+	}
+	return message
+}
+
+// cleanReason trims a cancellation reason and cuts it to maxCancelReason
+func cleanReason(reason string) string {
+	reason = strings.TrimSpace(reason)
+	if runes := []rune(reason); len(runes) > maxCancelReason {
+		reason = string(runes[:maxCancelReason])
+	}
+	return reason
+}
+
+// cancelBooking removes the event or seat of a booking, forgets it and
+// notifies the owner. With CANCEL_KEEP_EVENT a booking's own event stays in
+// the calendar marked as cancelled, with the reason in its description.
+func cancelBooking(record *Booking, reason string) error {
+	reason = cleanReason(reason)
+	if reason != "" {
+		log.Printf("Cancellation reason for %s: %q", record.Code, reason)
+	}
+
+	var err error
+	switch {
+	case record.Seat:
+		err = cancelSeat(record)
+	case CancelKeepEvent:
+		err = markEventCancelled(record.UID, reason)
+	default:
+		err = deleteBookingEvent(record.UID)
+	}
+	if err != nil {
+		return err
+	}
+
+	removeBooking(record.Code)
+	notify(Notification{Event: notifyCancelled, Booking: *record, Reason: reason})
+	notify(Notification{Event: notifyCancelled, Owner: true, Booking: *record, Reason: reason})
+	return nil
+}
+
+// markEventCancelled sets STATUS:CANCELLED on an event so it no longer
+// blocks its time, keeping it in the calendar as a record
+func markEventCancelled(uid, reason string) error {
+	ctx := context.Background()
+
+	cal, err := backend.FindByUID(ctx, uid)
+	if errors.Is(err, ErrEventNotFound) {
+		log.Printf("Event already missing: %s", uid)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	event := calendarEvent(cal)
+	if event == nil {
+		return fmt.Errorf("calendar object %s has no event", uid)
+	}
+
+	if reason != "" {
+		description, _ := event.Props.Text(ical.PropDescription)
+		event.Props.SetText(ical.PropDescription, description+"\nCancellation reason: "+reason)
+	}
+	event.Props.SetText(ical.PropStatus, "CANCELLED")
+	removeAlarms(event)
+	event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+	incrementSequence(event)
+
+	log.Printf("Marking event cancelled: %s", uid)
+	return backend.UpdateEvent(ctx, cal)
+}
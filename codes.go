@@ -0,0 +1,206 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	CodeMaxAttempts = getEnvInt("CODE_MAX_ATTEMPTS", 5)                                  // Failed code attempts before a lockout
+	CodeLockout     = time.Duration(getEnvInt("CODE_LOCKOUT_MINUTES", 15)) * time.Minute // Lockout and attempt counting window
+	TrustProxy      = getEnvStr("TRUST_PROXY", "false") == "true"                        // Take the client IP from X-Forwarded-For
+
+	codeAttempts = newAttemptLimiter()
+)
+
+// Booking codes are 80 random bits in Crockford's base32, grouped for
+// reading aloud: ABCD-EFGH-JKMN-PQRS
+const (
+	crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	codeLength        = 16
+	codeGroupSize     = 4
+	codePrefixLength  = 4 // Characters that identify a code family for attempt limits
+)
+
+// newBookingCode returns a fresh random booking code
+func newBookingCode() string {
+	random := make([]byte, codeLength)
+	if _, err := rand.Read(random); err != nil {
+		log.Fatalf("Error generating booking code: %v", err)
+	}
+
+	code := make([]byte, codeLength)
+	for i, b := range random {
+		code[i] = crockfordAlphabet[b&31]
+	}
+	return groupCode(string(code))
+}
+
+// normalizeCode converts user input to the canonical grouped form, mapping
+// the letters Crockford's base32 treats as look-alikes. It returns an empty
+// string when the input cannot be a code.
+func normalizeCode(input string) string {
+	var code strings.Builder
+	for _, r := range strings.ToUpper(input) {
+		switch r {
+		case '-', ' ':
+			continue
+		case 'O':
+			r = '0'
+		case 'I', 'L':
+			r = '1'
+		}
+		if !strings.ContainsRune(crockfordAlphabet, r) {
+			return ""
+		}
+		code.WriteRune(r)
+	}
+
+	if code.Len() != codeLength {
+		return ""
+	}
+	return groupCode(code.String())
+}
+
+func groupCode(code string) string {
+	var groups []string
+	for i := 0; i < len(code); i += codeGroupSize {
+		groups = append(groups, code[i:i+codeGroupSize])
+	}
+	return strings.Join(groups, "-")
+}
+
+// findBookingByCode looks a booking up by a code entered by a user. Every
+// stored code is compared in constant time so timing does not reveal how
+// much of a guess was right.
+func findBookingByCode(input string) (*Booking, bool) {
+	code := normalizeCode(input)
+	if code == "" {
+		return nil, false
+	}
+
+	bookingsMutex.RLock()
+	defer bookingsMutex.RUnlock()
+
+	var found *Booking
+	for stored, b := range bookings {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(code)) == 1 {
+			found = b
+		}
+	}
+	return found, found != nil
+}
+
+// attemptLimiter counts failed attempts per key and locks a key out once
+// it reaches CODE_MAX_ATTEMPTS within CODE_LOCKOUT_MINUTES
+type attemptLimiter struct {
+	mu       sync.Mutex
+	attempts map[string]*attemptState
+}
+
+type attemptState struct {
+	failures    int
+	first       time.Time
+	lockedUntil time.Time
+}
+
+func newAttemptLimiter() *attemptLimiter {
+	return &attemptLimiter{attempts: make(map[string]*attemptState)}
+}
+
+// Locked reports whether any of the keys is locked out
+func (l *attemptLimiter) Locked(keys ...string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		if state, exists := l.attempts[key]; exists && now.Before(state.lockedUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fail records a failed attempt for every key
+func (l *attemptLimiter) Fail(keys ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		state, exists := l.attempts[key]
+		if !exists || now.Sub(state.first) > CodeLockout {
+			state = &attemptState{first: now}
+			l.attempts[key] = state
+		}
+		state.failures++
+		if state.failures >= CodeMaxAttempts {
+			state.lockedUntil = now.Add(CodeLockout)
+		}
+	}
+
+	// Forget stale entries so the map does not grow without bound
+	for key, state := range l.attempts {
+		if now.Sub(state.first) > CodeLockout && now.After(state.lockedUntil) {
+			delete(l.attempts, key)
+		}
+	}
+}
+
+// attemptKeys returns the limiter keys of a request: the client IP and the
+// prefix of the code tried
+func attemptKeys(r *http.Request, code string) []string {
+	keys := []string{"ip:" + clientIP(r)}
+
+	if normalized := normalizeCode(code); normalized != "" {
+		keys = append(keys, "prefix:"+normalized[:codePrefixLength])
+	}
+	return keys
+}
+
+// checkCodeAttempt looks up a booking by code unless the client or the
+// code prefix is locked out. Failures are counted and audited.
+func checkCodeAttempt(r *http.Request, code, action string) (*Booking, bool, bool) {
+	keys := attemptKeys(r, code)
+	if codeAttempts.Locked(keys...) {
+		audit("code_locked_out", map[string]string{"ip": clientIP(r), "action": action})
+		return nil, false, true
+	}
+
+	record, exists := findBookingByCode(code)
+	if !exists {
+		codeAttempts.Fail(keys...)
+		// Only the prefix the limiter counts, a near miss of a real code
+		// must not end up in the log
+		fields := map[string]string{"ip": clientIP(r), "action": action}
+		if normalized := normalizeCode(code); normalized != "" {
+			fields["prefix"] = normalized[:codePrefixLength]
+		}
+		audit("code_attempt_failed", fields)
+		return nil, false, false
+	}
+	return record, true, false
+}
+
+// clientIP returns the address of the client, from X-Forwarded-For when
+// TRUST_PROXY is set
+func clientIP(r *http.Request) string {
+	if TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeCode(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"7KQ2-MX9D-4HZT-P0WB", "7KQ2-MX9D-4HZT-P0WB"},
+		{"7kq2mx9d4hztp0wb", "7KQ2-MX9D-4HZT-P0WB"},
+		{" 7KQ2 MX9D-4hzt P0WB ", "7KQ2-MX9D-4HZT-P0WB"},
+		{"7KQ2-MX9D-4HZT-POWB", "7KQ2-MX9D-4HZT-P0WB"},
+		{"7kq2-mx9d-4hzt-powb", "7KQ2-MX9D-4HZT-P0WB"},
+		{"ILl1-0000-0000-0000", "1111-0000-0000-0000"},
+		{"7KQ2-MX9D-4HZT-P0W", ""},   // Too short
+		{"7KQ2-MX9D-4HZT-P0WBX", ""}, // Too long
+		{"7KQ2-MX9D-4HZT-P0WU", ""},  // U is not in the alphabet
+		{"7KQ2_MX9D_4HZT_P0WB", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := normalizeCode(test.input); got != test.want {
+			t.Errorf("normalizeCode(%q) = %q, want %q", test.input, got, test.want)
+		}
+	}
+}
+
+func TestNewBookingCodeIsNormalized(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		code := newBookingCode()
+		if normalizeCode(code) != code {
+			t.Fatalf("new code %q does not normalize to itself", code)
+		}
+	}
+}
+
+func TestAttemptLimiter(t *testing.T) {
+	maxAttempts, lockout := CodeMaxAttempts, CodeLockout
+	CodeMaxAttempts, CodeLockout = 3, 15*time.Minute
+	t.Cleanup(func() { CodeMaxAttempts, CodeLockout = maxAttempts, lockout })
+
+	t.Run("locks out after the maximum", func(t *testing.T) {
+		l := newAttemptLimiter()
+		for i := 1; i < CodeMaxAttempts; i++ {
+			l.Fail("ip:a", "prefix:7KQ2")
+			if l.Locked("ip:a") {
+				t.Fatalf("locked after %d failures", i)
+			}
+		}
+
+		l.Fail("ip:a", "prefix:7KQ2")
+		if !l.Locked("ip:a") || !l.Locked("prefix:7KQ2") {
+			t.Fatal("not locked after the maximum of failures")
+		}
+		if !l.Locked("ip:b", "prefix:7KQ2") {
+			t.Error("a locked prefix does not lock out another client")
+		}
+		if l.Locked("ip:b", "prefix:ABCD") {
+			t.Error("unrelated keys are locked")
+		}
+	})
+
+	t.Run("lockout ends", func(t *testing.T) {
+		l := newAttemptLimiter()
+		for i := 0; i < CodeMaxAttempts; i++ {
+			l.Fail("ip:a")
+		}
+
+		// Move the attempts back in time past the lockout
+		state := l.attempts["ip:a"]
+		state.first = state.first.Add(-CodeLockout - time.Second)
+		state.lockedUntil = state.lockedUntil.Add(-CodeLockout - time.Second)
+		if l.Locked("ip:a") {
+			t.Fatal("still locked after the lockout")
+		}
+
+		l.Fail("ip:a")
+		if l.Locked("ip:a") {
+			t.Error("failures from before the window still count")
+		}
+		if got := l.attempts["ip:a"].failures; got != 1 {
+			t.Errorf("failures = %d, want a fresh count of 1", got)
+		}
+	})
+
+	t.Run("failures outside the window do not add up", func(t *testing.T) {
+		l := newAttemptLimiter()
+		for i := 1; i < CodeMaxAttempts; i++ {
+			l.Fail("ip:a")
+		}
+		l.attempts["ip:a"].first = time.Now().Add(-CodeLockout - time.Second)
+
+		l.Fail("ip:a")
+		if l.Locked("ip:a") {
+			t.Error("locked by failures spread over more than the window")
+		}
+	})
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-ical"
+)
+
+// Contact channels a booker can leave
+const (
+	channelEmail    = "email"
+	channelPhone    = "phone"
+	channelTelegram = "telegram"
+	channelMatrix   = "matrix"
+	channelOther    = "other" // Free text, such as a Jami ID or a URL
+)
+
+// Requirement levels of a contact channel
+const (
+	contactRequired = "required"
+	contactOptional = "optional"
+	contactOff      = "off"
+)
+
+// maxOtherContact limits free-text contacts
+const maxOtherContact = 200
+
+// propContact holds a contact of the booker in the event, with the channel
+// in paramChannel and the booking code in paramBookingCode
+const (
+	propContact  = "X-BOOKMYMEET-CONTACT"
+	paramChannel = "X-CHANNEL"
+)
+
+// ContactChannel is a kind of contact information and how it is asked for
+type ContactChannel struct {
+	Type     string `json:"type"`
+	Label    string `json:"label"`
+	Required bool   `json:"required,omitempty"`
+
+	level string
+	check func(string) (string, bool) // Validates and normalizes a value
+}
+
+// contactChannels in the order they are shown and detected in free text
+var contactChannels = []*ContactChannel{
+	{Type: channelEmail, Label: "Email", level: getEnvStr("CONTACT_EMAIL", contactOptional), check: checkEmail},
+	{Type: channelPhone, Label: "Phone", level: getEnvStr("CONTACT_PHONE", contactOptional), check: checkE164},
+	{Type: channelTelegram, Label: "Telegram", level: getEnvStr("CONTACT_TELEGRAM", contactOptional), check: checkTelegram},
+	{Type: channelMatrix, Label: "Matrix", level: getEnvStr("CONTACT_MATRIX", contactOptional), check: checkMatrix},
+	{Type: channelOther, Label: "Other contact", level: getEnvStr("CONTACT_OTHER", contactOptional), check: checkOther},
+}
+
+var (
+	telegramPattern = regexp.MustCompile(`^@?([A-Za-z][A-Za-z0-9_]{4,31})$`)
+	matrixPattern   = regexp.MustCompile(`^@[a-z0-9._=/+-]+:[a-z0-9.-]+(:[0-9]{1,5})?$`)
+	e164Pattern     = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+)
+
+// Contact is one way to reach the booker
+type Contact struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// initContactChannels checks the CONTACT_* requirement levels
+func initContactChannels() {
+	enabled := 0
+	for _, c := range contactChannels {
+		switch c.level {
+		case contactRequired:
+			c.Required = true
+		case contactOptional:
+		case contactOff:
+			continue
+		default:
+			log.Fatalf("Invalid CONTACT_%s: %s", strings.ToUpper(c.Type), c.level)
+		}
+		enabled++
+	}
+	if enabled == 0 {
+		log.Fatalf("At least one contact channel must be enabled")
+	}
+}
+
+// enabledContactChannels returns the channels the booking form asks for
+func enabledContactChannels() []ContactChannel {
+	var channels []ContactChannel
+	for _, c := range contactChannels {
+		if c.level != contactOff {
+			channels = append(channels, *c)
+		}
+	}
+	return channels
+}
+
+func findContactChannel(channel string) (*ContactChannel, bool) {
+	for _, c := range contactChannels {
+		if c.Type == channel {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// checkContacts validates the contacts of a request against the channel
+// settings. Clients that send a single free-text contactInfo get it sorted
+// into a channel. It returns the contacts in channel order, or an error
+// message for the booker.
+func checkContacts(values map[string]string, contactInfo string) ([]Contact, string) {
+	if len(values) == 0 && strings.TrimSpace(contactInfo) != "" {
+		values = make(map[string]string)
+		for _, contact := range parseContactInfo(contactInfo) {
+			values[contact.Type] = contact.Value
+		}
+	}
+
+	for channel := range values {
+		if _, ok := findContactChannel(channel); !ok {
+			return nil, fmt.Sprintf("Unknown contact type: %s", channel)
+		}
+	}
+
+	var contacts []Contact
+	for _, c := range contactChannels {
+		value := strings.TrimSpace(values[c.Type])
+		switch {
+		case value == "" && c.Required:
+			return nil, fmt.Sprintf("Please enter your %s", c.Label)
+		case value == "":
+			continue
+		case c.level == contactOff:
+			return nil, fmt.Sprintf("%s contacts are not accepted", c.Label)
+		}
+
+		normalized, ok := c.check(value)
+		if !ok {
+			return nil, fmt.Sprintf("Invalid %s: %s", c.Label, value)
+		}
+		contacts = append(contacts, Contact{Type: c.Type, Value: normalized})
+	}
+
+	if len(contacts) == 0 {
+		return nil, "All fields are required"
+	}
+	return contacts, ""
+}
+
+// parseContactInfo sorts free text into channels. A comma-separated list
+// is split when every part is recognized, as shown by contactSummary.
+func parseContactInfo(text string) []Contact {
+	text = strings.TrimSpace(text)
+	if parts := strings.Split(text, ","); len(parts) > 1 {
+		var contacts []Contact
+		seen := make(map[string]bool)
+		for _, part := range parts {
+			contact := classifyContact(part)
+			if contact.Type == channelOther || seen[contact.Type] {
+				contacts = nil
+				break
+			}
+			seen[contact.Type] = true
+			contacts = append(contacts, contact)
+		}
+		if contacts != nil {
+			return contacts
+		}
+	}
+	return []Contact{classifyContact(text)}
+}
+
+// classifyContact finds the first enabled channel a value is valid for,
+// or falls back to free text
+func classifyContact(value string) Contact {
+	value = strings.TrimSpace(value)
+	for _, c := range contactChannels {
+		if c.Type == channelOther || c.level == contactOff {
+			continue
+		}
+		if normalized, ok := c.check(value); ok {
+			return Contact{Type: c.Type, Value: normalized}
+		}
+	}
+	return Contact{Type: channelOther, Value: value}
+}
+
+// contactSummary is the single line stored as ContactInfo
+func contactSummary(contacts []Contact) string {
+	values := make([]string, len(contacts))
+	for i, contact := range contacts {
+		values[i] = contact.Value
+	}
+	return strings.Join(values, ", ")
+}
+
+// contact returns the booker's contact of a channel, or an empty string.
+// Bookings stored before channels existed have their ContactInfo sorted.
+func (b Booking) contact(channel string) string {
+	if b.Contacts == nil {
+		return findContact(parseContactInfo(b.ContactInfo), channel)
+	}
+	return findContact(b.Contacts, channel)
+}
+
+func findContact(contacts []Contact, channel string) string {
+	for _, contact := range contacts {
+		if contact.Type == channel {
+			return contact.Value
+		}
+	}
+	return ""
+}
+
+func checkEmail(value string) (string, bool) {
+	addr, err := mail.ParseAddress(value)
+	if err != nil {
+		return "", false
+	}
+	return addr.Address, true
+}
+
+// checkE164 accepts international numbers with a leading + and the usual
+// separators, and returns them in E.164 form
+func checkE164(value string) (string, bool) {
+	number, ok := validPhone(value)
+	if !ok || !e164Pattern.MatchString(number) {
+		return "", false
+	}
+	return number, true
+}
+
+// checkTelegram accepts usernames with or without the leading @
+func checkTelegram(value string) (string, bool) {
+	match := telegramPattern.FindStringSubmatch(value)
+	if match == nil {
+		return "", false
+	}
+	return "@" + match[1], true
+}
+
+// checkMatrix accepts user IDs such as @alice:example.org
+func checkMatrix(value string) (string, bool) {
+	value = strings.ToLower(value)
+	if !matrixPattern.MatchString(value) {
+		return "", false
+	}
+	return value, true
+}
+
+func checkOther(value string) (string, bool) {
+	if strings.ContainsAny(value, "\r\n") || len([]rune(value)) > maxOtherContact {
+		return "", false
+	}
+	return value, true
+}
+
+// setContactProps writes the contacts of a booking as X-BOOKMYMEET-CONTACT
+// properties, replacing those written for the booking before
+func setContactProps(event *ical.Component, record *Booking) {
+	removeBookingProps(event, propContact, record.Code)
+	for _, contact := range record.Contacts {
+		prop := ical.NewProp(propContact)
+		prop.Params.Set(paramChannel, contact.Type)
+		prop.Params.Set(paramBookingCode, record.Code)
+		prop.SetText(contact.Value)
+		event.Props.Add(prop)
+	}
+}
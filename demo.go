@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// The CalDAV client joins request paths without a trailing slash, so the
+// server compares against these exact forms
+const (
+	demoPrincipalPath = "/demo"
+	demoHomeSetPath   = "/demo/calendars"
+)
+
+// demoCalDAVBackend is an in-memory caldav.Backend used by --demo mode
+type demoCalDAVBackend struct {
+	mu        sync.RWMutex
+	calendars map[string]*caldav.Calendar
+	objects   map[string]map[string]*caldav.CalendarObject // Objects by calendar path and object path
+}
+
+func newDemoCalDAVBackend() *demoCalDAVBackend {
+	return &demoCalDAVBackend{
+		calendars: make(map[string]*caldav.Calendar),
+		objects:   make(map[string]map[string]*caldav.CalendarObject),
+	}
+}
+
+// calendarPathOf returns the calendar collection path for a calendar or
+// object path, always with a trailing slash
+func calendarPathOf(p string) string {
+	p = path.Clean(p)
+	if strings.HasSuffix(p, ".ics") {
+		p = path.Dir(p)
+	}
+	return p + "/"
+}
+
+func (b *demoCalDAVBackend) CurrentUserPrincipal(ctx context.Context) (string, error) {
+	return demoPrincipalPath, nil
+}
+
+func (b *demoCalDAVBackend) CalendarHomeSetPath(ctx context.Context) (string, error) {
+	return demoHomeSetPath, nil
+}
+
+func (b *demoCalDAVBackend) CreateCalendar(ctx context.Context, calendar *caldav.Calendar) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	p := calendarPathOf(calendar.Path)
+	cal := *calendar
+	cal.Path = p
+	if len(cal.SupportedComponentSet) == 0 {
+		cal.SupportedComponentSet = []string{ical.CompEvent}
+	}
+	b.calendars[p] = &cal
+	if b.objects[p] == nil {
+		b.objects[p] = make(map[string]*caldav.CalendarObject)
+	}
+	return nil
+}
+
+func (b *demoCalDAVBackend) ListCalendars(ctx context.Context) ([]caldav.Calendar, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	calendars := make([]caldav.Calendar, 0, len(b.calendars))
+	for _, cal := range b.calendars {
+		calendars = append(calendars, *cal)
+	}
+	return calendars, nil
+}
+
+func (b *demoCalDAVBackend) GetCalendar(ctx context.Context, p string) (*caldav.Calendar, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	cal, exists := b.calendars[calendarPathOf(p)]
+	if !exists {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("calendar %s not found", p))
+	}
+	return cal, nil
+}
+
+func (b *demoCalDAVBackend) GetCalendarObject(ctx context.Context, p string, req *caldav.CalendarCompRequest) (*caldav.CalendarObject, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	obj, exists := b.objects[calendarPathOf(p)][path.Clean(p)]
+	if !exists {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("object %s not found", p))
+	}
+	return obj, nil
+}
+
+func (b *demoCalDAVBackend) ListCalendarObjects(ctx context.Context, p string, req *caldav.CalendarCompRequest) ([]caldav.CalendarObject, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	objects, exists := b.objects[calendarPathOf(p)]
+	if !exists {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("calendar %s not found", p))
+	}
+
+	list := make([]caldav.CalendarObject, 0, len(objects))
+	for _, obj := range objects {
+		list = append(list, *obj)
+	}
+	return list, nil
+}
+
+func (b *demoCalDAVBackend) QueryCalendarObjects(ctx context.Context, p string, query *caldav.CalendarQuery) ([]caldav.CalendarObject, error) {
+	objects, err := b.ListCalendarObjects(ctx, p, &query.CompRequest)
+	if err != nil {
+		return nil, err
+	}
+	return caldav.Filter(query, objects)
+}
+
+func (b *demoCalDAVBackend) PutCalendarObject(ctx context.Context, p string, cal *ical.Calendar, opts *caldav.PutCalendarObjectOptions) (*caldav.CalendarObject, error) {
+	if _, _, err := caldav.ValidateCalendarObject(cal); err != nil {
+		return nil, webdav.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	calPath := calendarPathOf(p)
+	if _, exists := b.calendars[calPath]; !exists {
+		return nil, webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("calendar %s not found", calPath))
+	}
+
+	now := time.Now()
+	obj := &caldav.CalendarObject{
+		Path:    path.Clean(p),
+		ModTime: now,
+		ETag:    fmt.Sprintf("%x", now.UnixNano()),
+		Data:    cal,
+	}
+	b.objects[calPath][obj.Path] = obj
+	return obj, nil
+}
+
+func (b *demoCalDAVBackend) DeleteCalendarObject(ctx context.Context, p string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	objects := b.objects[calendarPathOf(p)]
+	if _, exists := objects[path.Clean(p)]; !exists {
+		return webdav.NewHTTPError(http.StatusNotFound, fmt.Errorf("object %s not found", p))
+	}
+	delete(objects, path.Clean(p))
+	return nil
+}
+
+// seedDemoCalendars creates a default booking calendar with a few meetings
+// and a holidays calendar with all-day events
+func seedDemoCalendars(b *demoCalDAVBackend) {
+	ctx := context.Background()
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	b.CreateCalendar(ctx, &caldav.Calendar{Path: demoHomeSetPath + "/default/", Name: "Default"})
+	b.CreateCalendar(ctx, &caldav.Calendar{Path: demoHomeSetPath + "/holidays/", Name: "Holidays"})
+	b.CreateCalendar(ctx, &caldav.Calendar{Path: demoHomeSetPath + "/availability/", Name: "Availability"})
+
+	put := func(calendar, uid string, setup func(event *ical.Event)) {
+		event := ical.NewEvent()
+		event.Props.SetText(ical.PropUID, uid+"@demo")
+		event.Props.SetDateTime(ical.PropDateTimeStamp, time.Now().UTC())
+		setup(event)
+
+		cal := ical.NewCalendar()
+		cal.Props.SetText(ical.PropVersion, "2.0")
+		cal.Props.SetText(ical.PropProductID, "-//Book my meet//Demo//EN")
+		cal.Children = append(cal.Children, event.Component)
+
+		if _, err := b.PutCalendarObject(ctx, demoHomeSetPath+"/"+calendar+"/"+uid+".ics", cal, nil); err != nil {
+			log.Printf("Error seeding demo event %s: %v", uid, err)
+		}
+	}
+
+	// Daily stand-up on weekdays
+	put("default", "standup", func(event *ical.Event) {
+		start := today.AddDate(0, 0, -7).Add(9 * time.Hour)
+		event.Props.SetText(ical.PropSummary, "Stand-up")
+		event.Props.SetDateTime(ical.PropDateTimeStart, start)
+		event.Props.SetDateTime(ical.PropDateTimeEnd, start.Add(30*time.Minute))
+		setDemoRRule(event, "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR")
+	})
+
+	// Weekly planning every Wednesday afternoon
+	put("default", "planning", func(event *ical.Event) {
+		start := today.Add(14 * time.Hour)
+		for start.Weekday() != time.Wednesday {
+			start = start.AddDate(0, 0, 1)
+		}
+		event.Props.SetText(ical.PropSummary, "Planning")
+		event.Props.SetDateTime(ical.PropDateTimeStart, start)
+		event.Props.SetDateTime(ical.PropDateTimeEnd, start.Add(2*time.Hour))
+		setDemoRRule(event, "FREQ=WEEKLY;INTERVAL=1")
+	})
+
+	// One-off meetings over the next days
+	for i, hour := range []int{11, 15, 10} {
+		start := today.AddDate(0, 0, i+1).Add(time.Duration(hour) * time.Hour)
+		put("default", fmt.Sprintf("meeting-%d", i+1), func(event *ical.Event) {
+			event.Props.SetText(ical.PropSummary, fmt.Sprintf("Client meeting %d", i+1))
+			event.Props.SetDateTime(ical.PropDateTimeStart, start)
+			event.Props.SetDateTime(ical.PropDateTimeEnd, start.Add(time.Hour))
+		})
+	}
+
+	// Office hours used with AVAILABILITY_MODE=calendar
+	put("availability", "office-hours-morning", func(event *ical.Event) {
+		start := today.AddDate(0, 0, -7).Add(9*time.Hour + 30*time.Minute)
+		event.Props.SetText(ical.PropSummary, "Office hours")
+		event.Props.SetDateTime(ical.PropDateTimeStart, start)
+		event.Props.SetDateTime(ical.PropDateTimeEnd, start.Add(3*time.Hour))
+		setDemoRRule(event, "FREQ=WEEKLY;BYDAY=MO,WE,FR")
+	})
+	put("availability", "office-hours-afternoon", func(event *ical.Event) {
+		start := today.AddDate(0, 0, -7).Add(13 * time.Hour)
+		event.Props.SetText(ical.PropSummary, "Office hours")
+		event.Props.SetDateTime(ical.PropDateTimeStart, start)
+		event.Props.SetDateTime(ical.PropDateTimeEnd, start.Add(4*time.Hour))
+		setDemoRRule(event, "FREQ=WEEKLY;BYDAY=TU,TH")
+	})
+
+	// All-day events block whole days
+	put("holidays", "offsite", func(event *ical.Event) {
+		event.Props.SetText(ical.PropSummary, "Team offsite")
+		event.Props.SetDate(ical.PropDateTimeStart, today.AddDate(0, 0, 5))
+		event.Props.SetDate(ical.PropDateTimeEnd, today.AddDate(0, 0, 7))
+	})
+	put("holidays", "company-day", func(event *ical.Event) {
+		event.Props.SetText(ical.PropSummary, "Company day")
+		event.Props.SetDate(ical.PropDateTimeStart, today.AddDate(-1, 0, 10))
+		event.Props.SetDate(ical.PropDateTimeEnd, today.AddDate(-1, 0, 11))
+		setDemoRRule(event, "FREQ=YEARLY")
+	})
+}
+
+// setDemoRRule stores a raw recurrence rule; SetText would mark it as TEXT
+func setDemoRRule(event *ical.Event, rule string) {
+	prop := ical.NewProp(ical.PropRecurrenceRule)
+	prop.Value = rule
+	event.Props.Set(prop)
+}
+
+// startDemoServer serves a seeded in-process CalDAV server on a random
+// local port and points the CalDAV configuration at it
+func startDemoServer() {
+	b := newDemoCalDAVBackend()
+	seedDemoCalendars(b)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatalf("Error starting demo CalDAV server: %v", err)
+	}
+
+	go func() {
+		log.Fatal(http.Serve(listener, &caldav.Handler{Backend: b}))
+	}()
+
+	serverURL := fmt.Sprintf("http://%s%s/", listener.Addr(), demoHomeSetPath)
+	CalendarBackendType = "caldav"
+	caldavConfig = CalDAVConfig{
+		ServerURL:           serverURL,
+		Auth:                AuthConfig{Method: "none"},
+		Calendar:            "default",
+		AdditionalCalendars: []string{"holidays"},
+	}
+
+	if AvailabilityCalendar == "" {
+		AvailabilityCalendar = "availability"
+	}
+
+	log.Printf("Demo mode: CalDAV server with sample events at %s", serverURL)
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+var (
+	SMTPHost      = getEnvStr("SMTP_HOST", "")                   // Mail server, emails are off if unset
+	SMTPPort      = getEnvInt("SMTP_PORT", 587)                  // Mail server port
+	SMTPStartTLS  = getEnvStr("SMTP_STARTTLS", "true") == "true" // Require STARTTLS before sending
+	SMTPUsername  = getEnvStr("SMTP_USERNAME", "")               // Mail server username, no authentication if unset
+	SMTPPassword  = getEnvSecret("SMTP_PASSWORD", "")            // Mail server password
+	SMTPFrom      = getEnvStr("SMTP_FROM", SMTPUsername)         // Sender address
+	OwnerEmail    = getEnvStr("OWNER_EMAIL", "")                 // Where the owner's copies go
+	OwnerTimezone = getEnvStr("OWNER_TIMEZONE", "UTC")           // Timezone of times in the owner's copies
+)
+
+var SMTPTLS = getEnvStr("SMTP_TLS", strconv.FormatBool(SMTPPort == 465)) == "true" // Connect with TLS from the start, the default on port 465
+
+// emailKind describes the message sent for a notification event. The
+// texts are the defaults templates get as .Title and .Intro.
+type emailKind struct {
+	subject      string // Subject for the booker
+	ownerSubject string // Subject for the owner
+	intro        string // Opening sentence for the booker
+	ownerIntro   string // Opening sentence for the owner
+	method       string // iTIP method of the attached invitation, none if empty
+}
+
+var emailKinds = map[string]emailKind{
+	notifyConfirmed: {
+		subject: "Booking confirmed", ownerSubject: "New booking",
+		intro: "Your meeting is booked.", ownerIntro: "A meeting was booked.",
+		method: "REQUEST",
+	},
+	notifyRescheduled: {
+		subject: "Booking moved", ownerSubject: "Booking moved",
+		intro: "Your meeting was moved.", ownerIntro: "A booking was moved by the booker.",
+		method: "REQUEST",
+	},
+	notifyMoved: {
+		subject: "Booking moved by the organizer", ownerSubject: "Booking moved",
+		intro: "The organizer moved your meeting.", ownerIntro: "A booking was moved in the calendar.",
+		method: "REQUEST",
+	},
+	notifyCancelled: {
+		subject: "Booking cancelled", ownerSubject: "Booking cancelled",
+		intro: "Your meeting was cancelled.", ownerIntro: "A booking was cancelled by the booker.",
+		method: "CANCEL",
+	},
+	notifyOwnerCancelled: {
+		subject: "Booking cancelled by the organizer", ownerSubject: "Booking cancelled",
+		intro: "The organizer cancelled your meeting.", ownerIntro: "A booking was removed from the calendar.",
+		method: "CANCEL",
+	},
+	notifyDeclined: {
+		subject: "Booking declined", ownerSubject: "Booking declined",
+		intro: "The organizer declined your meeting.", ownerIntro: "A booking was declined.",
+		method: "CANCEL",
+	},
+	notifyReminder: {
+		subject: "Reminder", ownerSubject: "Reminder",
+		intro: "Your meeting starts soon.", ownerIntro: "A booked meeting starts soon.",
+	},
+}
+
+// smtpNotifier emails the booker and their guests a message with an
+// invitation attached, and the owner a plain copy
+type smtpNotifier struct {
+	from      *mail.Address
+	tlsConfig *tls.Config
+}
+
+func newSMTPNotifier() *smtpNotifier {
+	from, err := mail.ParseAddress(SMTPFrom)
+	if err != nil {
+		log.Fatalf("Invalid SMTP_FROM address %q: %v", SMTPFrom, err)
+	}
+
+	// net/smtp refuses to send a password over a plain connection to
+	// anything but localhost
+	if SMTPUsername != "" && !SMTPTLS && !SMTPStartTLS && !isLocalhost(SMTPHost) {
+		log.Fatalf("SMTP_USERNAME needs an encrypted connection to %s: set SMTP_TLS=true (port 465) or SMTP_STARTTLS=true", SMTPHost)
+	}
+
+	log.Printf("Sending emails through %s:%d as %s", SMTPHost, SMTPPort, from.Address)
+	return &smtpNotifier{
+		from:      from,
+		tlsConfig: &tls.Config{ServerName: SMTPHost},
+	}
+}
+
+func (s *smtpNotifier) Notify(ctx context.Context, n Notification) error {
+	kind, ok := emailKinds[n.Event]
+	if !ok {
+		return nil
+	}
+
+	if n.Owner {
+		if OwnerEmail == "" {
+			return nil
+		}
+		to, err := mail.ParseAddress(OwnerEmail)
+		if err != nil {
+			return fmt.Errorf("invalid OWNER_EMAIL: %w", err)
+		}
+		content, err := renderEmail(n, kind, ownerLocation, OwnerLanguage, "")
+		if err != nil {
+			return err
+		}
+		msg, err := s.message(to, content, nil, "")
+		if err != nil {
+			return err
+		}
+		return s.send(ctx, to.Address, msg)
+	}
+
+	var errs []error
+	// The booker may have left only a phone number or chat handle
+	if email := n.Booking.contact(channelEmail); email != "" {
+		to := &mail.Address{Name: n.Booking.FullName, Address: email}
+		method := kind.method
+		if !emailsInvitation(n.Booking) {
+			method = ""
+		}
+		errs = append(errs, s.notifyAttendee(ctx, n, kind, to, method, n.Booking.Invited, ""))
+	}
+
+	// Guests are attendees whenever an invitation is sent, and always get
+	// it by email
+	method := kind.method
+	if InvitationMode == invitationNone {
+		method = ""
+	}
+	for _, guest := range n.Booking.Guests {
+		errs = append(errs, s.notifyAttendee(ctx, n, kind, &mail.Address{Address: guest}, method, true, guest))
+	}
+	return errors.Join(errs...)
+}
+
+// notifyAttendee emails the booker or a guest, with the invitation of the
+// method attached unless it is empty. With rsvp the invitation asks for an
+// answer.
+func (s *smtpNotifier) notifyAttendee(ctx context.Context, n Notification, kind emailKind, to *mail.Address, method string, rsvp bool, guest string) error {
+	var invite []byte
+	var err error
+	if method != "" {
+		if invite, err = bookingInvite(n.Booking, method, organizerAddress(), to, rsvp, guest != ""); err != nil {
+			return err
+		}
+	}
+	content, err := renderEmail(n, kind, bookerLocation(n.Booking), n.Booking.Language, guest)
+	if err != nil {
+		return err
+	}
+	msg, err := s.message(to, content, invite, method)
+	if err != nil {
+		return err
+	}
+	return s.send(ctx, to.Address, msg)
+}
+
+// emailContent is the rendered subject and body of a message
+type emailContent struct {
+	subject string
+	text    string
+	html    string // Optional HTML alternative
+}
+
+// renderEmail renders the templates of a notification. Templates are
+// looked up as <event>.subject.txt, <event>.txt and <event>.html, then as
+// subject.txt, email.txt and email.html; the owner's copies use the same
+// names prefixed with "owner-".
+func renderEmail(n Notification, kind emailKind, loc *time.Location, language, guest string) (emailContent, error) {
+	data := messageData(n.Booking, n.Event, loc)
+	data.Reason = n.Reason
+	data.Title, data.Intro = kind.subject, kind.intro
+	if guest != "" {
+		// Guests cannot change the booking
+		data.Guest, data.ManageURL = guest, ""
+	}
+
+	prefix, generic := "", "email"
+	if n.Owner {
+		prefix, generic = "owner-", "owner"
+		data.Title, data.Intro = kind.ownerSubject, kind.ownerIntro
+	}
+
+	var content emailContent
+	var err error
+	if content.subject, err = renderText([]string{prefix + n.Event + ".subject.txt", prefix + "subject.txt"}, language, data); err != nil {
+		return content, err
+	}
+	if content.text, err = renderText([]string{prefix + n.Event + ".txt", generic + ".txt"}, language, data); err != nil {
+		return content, err
+	}
+	if content.html, err = renderHTML([]string{prefix + n.Event + ".html", generic + ".html"}, language, data); err != nil {
+		return content, err
+	}
+
+	// A subject is a single header line
+	content.subject = strings.Join(strings.Fields(content.subject), " ")
+	return content, nil
+}
+
+// formatMeetingTime shows the start and end of a booking in loc
+func formatMeetingTime(b Booking, loc *time.Location) string {
+	start, err := time.Parse("2006-01-02 15:04", b.Date+" "+b.Time)
+	if err != nil {
+		return b.Date + " " + b.Time + " UTC"
+	}
+	start = start.In(loc)
+	end := start.Add(time.Duration(b.Duration) * time.Minute)
+	return fmt.Sprintf("%s - %s (%s)", start.Format("Monday, 2 January 2006 15:04"), end.Format("15:04"), loc)
+}
+
+// bookerLocation returns the booker's timezone, UTC if unknown
+func bookerLocation(b Booking) *time.Location {
+	if loc, err := time.LoadLocation(b.Timezone); err == nil && b.Timezone != "" {
+		return loc
+	}
+	return time.UTC
+}
+
+// validTimezone returns the timezone name if it is known, or an empty string
+func validTimezone(name string) string {
+	if name == "" {
+		return ""
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// bookingInvite builds the iTIP invitation or cancellation for the booker
+// or a guest. A guest's copy leaves out the management link.
+func bookingInvite(b Booking, method string, organizer, attendee *mail.Address, rsvp, guest bool) ([]byte, error) {
+	cal, err := bookingCalendar(&b)
+	if err != nil {
+		return nil, err
+	}
+	cal.Props.SetText(ical.PropMethod, method)
+	event := calendarEvent(cal)
+	if guest {
+		event.Props.Del(ical.PropDescription)
+	}
+
+	event.Props.Set(organizerProp(organizer))
+
+	att := ical.NewProp(ical.PropAttendee)
+	att.Value = "mailto:" + attendee.Address
+	if attendee.Name != "" {
+		att.Params.Set(ical.ParamCommonName, paramValue(attendee.Name))
+	}
+	if rsvp && method == "REQUEST" {
+		// Calendar apps offer to accept or decline and send a REPLY
+		att.Params.Set(ical.ParamParticipationStatus, "NEEDS-ACTION")
+		att.Params.Set(ical.ParamRSVP, "TRUE")
+	} else {
+		att.Params.Set(ical.ParamParticipationStatus, "ACCEPTED")
+	}
+	event.Props.Set(att)
+
+	if method == "CANCEL" {
+		event.Props.Del(ical.PropDescription)
+		event.Props.SetText(ical.PropStatus, "CANCELLED")
+		setSequence(event, b.Sequence+1)
+	}
+
+	var buf bytes.Buffer
+	if err := ical.NewEncoder(&buf).Encode(cal); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// message builds a MIME message, with the invitation as an attachment
+// when one is given
+func (s *smtpNotifier) message(to *mail.Address, content emailContent, invite []byte, method string) ([]byte, error) {
+	var buf bytes.Buffer
+	header := textproto.MIMEHeader{}
+	header.Set("From", s.from.String())
+	header.Set("To", to.String())
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", content.subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", messageID(s.from.Address))
+	header.Set("MIME-Version", "1.0")
+
+	bodyHeader, body, err := content.entity()
+	if err != nil {
+		return nil, err
+	}
+
+	if invite == nil {
+		for key, values := range bodyHeader {
+			header[key] = values
+		}
+		writeHeader(&buf, header)
+		buf.Write(body)
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	header.Set("Content-Type", "multipart/mixed; boundary="+mw.Boundary())
+	writeHeader(&buf, header)
+
+	part, err := mw.CreatePart(bodyHeader)
+	if err != nil {
+		return nil, err
+	}
+	part.Write(body)
+
+	part, err = mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/calendar; charset=utf-8; method=" + method},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {`attachment; filename="invite.ics"`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(invite)
+	for len(encoded) > 76 {
+		fmt.Fprintf(part, "%s\r\n", encoded[:76])
+		encoded = encoded[76:]
+	}
+	fmt.Fprintf(part, "%s\r\n", encoded)
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// entity returns the headers and body of the readable part: plain text,
+// or plain text and HTML as alternatives
+func (c emailContent) entity() (textproto.MIMEHeader, []byte, error) {
+	var buf bytes.Buffer
+	if c.html == "" {
+		if err := writeQuotedPrintable(&buf, c.text); err != nil {
+			return nil, nil, err
+		}
+		return textproto.MIMEHeader{
+			"Content-Type":              {"text/plain; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		}, buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	for _, alternative := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", c.text},
+		{"text/html; charset=utf-8", c.html},
+	} {
+		part, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {alternative.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := writeQuotedPrintable(part, alternative.body); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, nil, err
+	}
+	return textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + mw.Boundary()},
+	}, buf.Bytes(), nil
+}
+
+func writeHeader(buf *bytes.Buffer, header textproto.MIMEHeader) {
+	for key, values := range header {
+		for _, value := range values {
+			fmt.Fprintf(buf, "%s: %s\r\n", key, value)
+		}
+	}
+	buf.WriteString("\r\n")
+}
+
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(strings.ReplaceAll(body, "\n", "\r\n"))); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func messageID(from string) string {
+	random := make([]byte, 12)
+	rand.Read(random)
+	domain := "bookmymeet"
+	if _, host, found := strings.Cut(from, "@"); found {
+		domain = host
+	}
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
+
+// send delivers a message over SMTP, upgrading with STARTTLS when
+// SMTP_STARTTLS is set
+func (s *smtpNotifier) send(ctx context.Context, to string, msg []byte) error {
+	address := net.JoinHostPort(SMTPHost, strconv.Itoa(SMTPPort))
+	var conn net.Conn
+	var err error
+	if SMTPTLS {
+		dialer := tls.Dialer{Config: s.tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if SMTPStartTLS && !SMTPTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("server %s does not support STARTTLS", SMTPHost)
+		}
+		if err := c.StartTLS(s.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if SMTPUsername != "" {
+		if err := c.Auth(smtp.PlainAuth("", SMTPUsername, SMTPPassword, SMTPHost)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(s.from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// isLocalhost reports whether host is the local machine, the only place
+// net/smtp sends a password to without TLS
+func isLocalhost(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
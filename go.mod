@@ -1,4 +1,4 @@
-module main
+module github.com/muratovas/bookMyMeet
 
 go 1.23.0
 
@@ -11,8 +11,8 @@ require (
 )
 
 require (
-	github.com/emersion/go-ical v0.0.0-20240127095438-fc1c9d8fb2b6 // indirect
-	github.com/teambition/rrule-go v1.8.2 // indirect
+	github.com/emersion/go-ical v0.0.0-20240127095438-fc1c9d8fb2b6
+	github.com/teambition/rrule-go v1.8.2
 )
 
-require golang.org/x/time v0.12.0 // indirect
+require golang.org/x/time v0.12.0
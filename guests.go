@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"github.com/emersion/go-ical"
+)
+
+var MaxGuests = getEnvInt("MAX_GUESTS", 5) // Extra attendees a booker can bring, 0 disables guests
+
+// paramGuestOf marks an ATTENDEE as a guest of the booking with the code
+const paramGuestOf = "X-BOOKMYMEET-GUEST"
+
+// parseGuests checks the guest addresses of a booking request and returns
+// them without names, duplicates and the booker's own address, or an error
+// message for the booker
+func parseGuests(values []string, bookerEmail string, meetingType MeetingType) ([]string, string) {
+	var guests []string
+	seen := map[string]bool{strings.ToLower(bookerEmail): true}
+
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(value)
+		if err != nil {
+			return nil, fmt.Sprintf("Invalid guest email: %s", value)
+		}
+		if key := strings.ToLower(addr.Address); !seen[key] {
+			seen[key] = true
+			guests = append(guests, addr.Address)
+		}
+	}
+
+	switch {
+	case len(guests) == 0:
+		return nil, ""
+	case meetingType.Seats > 1:
+		return nil, "Guests cannot be added to group sessions"
+	case MaxGuests <= 0:
+		return nil, "Guests cannot be added"
+	case len(guests) > MaxGuests:
+		return nil, fmt.Sprintf("At most %d guests can be added", MaxGuests)
+	}
+	return guests, ""
+}
+
+// isGuest reports whether the address is one of the booking's guests
+func isGuest(record *Booking, address string) bool {
+	for _, guest := range record.Guests {
+		if strings.EqualFold(guest, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// attendeeStatuses returns the PARTSTAT of every attendee of an event by
+// lowercase address, so rewriting the attendees keeps their answers
+func attendeeStatuses(event *ical.Component) map[string]string {
+	statuses := make(map[string]string)
+	for _, attendee := range event.Props.Values(ical.PropAttendee) {
+		statuses[attendeeEmail(attendee)] = attendee.Params.Get(ical.ParamParticipationStatus)
+	}
+	return statuses
+}
+
+// attendeeEmail returns the lowercase address of a mailto: ATTENDEE
+func attendeeEmail(attendee ical.Prop) string {
+	value := strings.ToLower(attendee.Value)
+	if !strings.HasPrefix(value, "mailto:") {
+		return ""
+	}
+	return strings.TrimPrefix(value, "mailto:")
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+var (
+	HolidayCalendars = getEnvStrSlice("HOLIDAY_CALENDARS", "")                     // ICS files or URLs with public holidays
+	HolidayRefresh   = time.Duration(getEnvInt("HOLIDAY_REFRESH", 24)) * time.Hour // Refresh interval for holiday calendars
+
+	holidaySources []*ICSSource
+)
+
+// initHolidayCalendars loads every holiday calendar once and keeps
+// refreshing it in the background
+func initHolidayCalendars() {
+	if HolidayRefresh <= 0 {
+		HolidayRefresh = 24 * time.Hour
+	}
+
+	for _, location := range HolidayCalendars {
+		location = strings.TrimSpace(location)
+		if location == "" {
+			continue
+		}
+
+		client, err := newAuthHTTPClient(AuthConfig{Method: "none"}, 30*time.Second)
+		if err != nil {
+			log.Fatalf("Error configuring holiday calendar %s: %v", location, err)
+		}
+
+		source := &ICSSource{
+			Name:    strings.TrimSuffix(path.Base(location), ".ics"),
+			URL:     location,
+			Mode:    "block",
+			Refresh: HolidayRefresh,
+			client:  client,
+		}
+		if err := source.fetch(context.Background()); err != nil {
+			log.Printf("Error loading holiday calendar %s: %v", source.Name, err)
+		}
+		go source.refreshLoop()
+
+		holidaySources = append(holidaySources, source)
+	}
+}
+
+// isHoliday reports whether an all-day event of a holiday calendar falls
+// on the date
+func isHoliday(date time.Time) bool {
+	dayStart := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	dayEnd := dayStart.AddDate(0, 0, 1)
+
+	for _, source := range holidaySources {
+		var allDay []*ical.Component
+		for _, event := range source.Events() {
+			if isAllDayEvent(event) {
+				allDay = append(allDay, event)
+			}
+		}
+		if len(componentIntervals(allDay, dayStart, dayEnd)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isAllDayEvent reports whether the event starts on a DATE rather than a
+// DATE-TIME. The VALUE parameter is optional, so the length is checked.
+func isAllDayEvent(event *ical.Component) bool {
+	dtstart := event.Props.Get(ical.PropDateTimeStart)
+	return dtstart != nil && len(dtstart.Value) == len("20060102")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// ICSSource is a read-only calendar exported as a plain .ics file or feed
+type ICSSource struct {
+	Name    string
+	URL     string        // Local file path, http(s):// or webcal:// URL
+	Mode    string        // busy: events block their own time, block: events close the whole day
+	Refresh time.Duration // How often the source is fetched again
+	Auth    AuthConfig    // Used for HTTP URLs
+
+	client *http.Client
+	mu     sync.RWMutex
+	events []*ical.Component
+}
+
+var icsSources []*ICSSource
+
+// loadICSSources reads ICS_SOURCE_<N>_* variables starting at N=1
+// until the first missing URL
+func loadICSSources() []*ICSSource {
+	var sources []*ICSSource
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("ICS_SOURCE_%d_", i)
+		url := getEnvStr(prefix+"URL", "")
+		if url == "" {
+			break
+		}
+
+		source := &ICSSource{
+			Name:    getEnvStr(prefix+"NAME", fmt.Sprintf("ics-%d", i)),
+			URL:     url,
+			Mode:    strings.ToLower(getEnvStr(prefix+"MODE", "busy")),
+			Refresh: time.Duration(getEnvInt(prefix+"REFRESH", 60)) * time.Minute,
+			Auth:    loadAuthConfig(prefix, ""),
+		}
+		if source.Mode != "busy" && source.Mode != "block" {
+			log.Fatalf("Unknown mode for ICS source %s: %s", source.Name, source.Mode)
+		}
+		if source.Refresh <= 0 {
+			source.Refresh = time.Hour
+		}
+
+		client, err := newAuthHTTPClient(source.Auth, 30*time.Second)
+		if err != nil {
+			log.Fatalf("Error configuring ICS source %s: %v", source.Name, err)
+		}
+		source.client = client
+
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// initICSSources loads every ICS source once and keeps refreshing it
+// in the background on its own schedule
+func initICSSources() {
+	icsSources = loadICSSources()
+
+	for _, source := range icsSources {
+		if err := source.fetch(context.Background()); err != nil {
+			log.Printf("Error loading ICS source %s: %v", source.Name, err)
+		}
+		go source.refreshLoop()
+		busySources = append(busySources, source)
+	}
+}
+
+func (s *ICSSource) refreshLoop() {
+	ticker := time.NewTicker(s.Refresh)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.fetch(context.Background()); err != nil {
+			// Keep serving the previously loaded events
+			log.Printf("Error refreshing ICS source %s: %v", s.Name, err)
+		}
+	}
+}
+
+// fetch downloads or reads the source and replaces its events
+func (s *ICSSource) fetch(ctx context.Context) error {
+	body, err := openICS(ctx, s.client, s.URL)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	events, err := parseICSEvents(body)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.events = events
+	s.mu.Unlock()
+
+	log.Printf("ICS source %s loaded with %d event(s)", s.Name, len(events))
+	return nil
+}
+
+// Events returns the last successfully loaded events
+func (s *ICSSource) Events() []*ical.Component {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.events
+}
+
+// openICS opens a local file or fetches an HTTP/webcal URL
+func openICS(ctx context.Context, client *http.Client, location string) (io.ReadCloser, error) {
+	if strings.HasPrefix(location, "webcal://") {
+		location = "https://" + strings.TrimPrefix(location, "webcal://")
+	}
+
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.Open(strings.TrimPrefix(location, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// parseICSEvents decodes every calendar in the stream and collects its events
+func parseICSEvents(r io.Reader) ([]*ical.Component, error) {
+	return parseICSComponents(r, ical.CompEvent)
+}
+
+// parseICSComponents decodes every calendar in the stream and collects
+// its top-level components with the given name
+func parseICSComponents(r io.Reader, name string) ([]*ical.Component, error) {
+	var components []*ical.Component
+
+	dec := ical.NewDecoder(r)
+	for {
+		cal, err := dec.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		components = append(components, componentsByName(cal, name)...)
+	}
+
+	return components, nil
+}
+
+// ListBusy expands the source events in the range. Events of blocking
+// sources close every day they touch.
+func (s *ICSSource) ListBusy(ctx context.Context, start, end time.Time) ([]Interval, error) {
+	intervals := componentIntervals(s.Events(), start, end)
+
+	if s.Mode != "block" {
+		return intervals, nil
+	}
+
+	for i, interval := range intervals {
+		dayStart := interval.Start.UTC().Truncate(24 * time.Hour)
+		dayEnd := interval.End.UTC().Truncate(24 * time.Hour)
+		if dayEnd.Before(interval.End) {
+			dayEnd = dayEnd.Add(24 * time.Hour)
+		}
+		intervals[i].Start, intervals[i].End = dayStart, dayEnd
+	}
+	return intervals, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/emersion/go-ical"
+)
+
+// Ways invitations reach the booker
+const (
+	invitationEmail  = "email"  // iMIP: the invitation is attached to the confirmation email
+	invitationCalDAV = "caldav" // The CalDAV server schedules it (RFC 6638 implicit scheduling)
+	invitationNone   = "none"   // No invitations
+)
+
+var InvitationMode = strings.ToLower(getEnvStr("INVITATION_MODE", invitationEmail)) // email, caldav or none
+
+// paramScheduleAgent tells a scheduling CalDAV server whether it should
+// deliver invitations to an attendee itself (RFC 6638, section 7.1)
+const paramScheduleAgent = "SCHEDULE-AGENT"
+
+// maxReplySize limits the iCalendar data of a REPLY
+const maxReplySize = 1 << 20
+
+// initInvitations checks INVITATION_MODE
+func initInvitations() {
+	switch InvitationMode {
+	case invitationEmail, invitationNone:
+	case invitationCalDAV:
+		if organizerAddress() == nil {
+			log.Fatalf("INVITATION_MODE=caldav needs OWNER_EMAIL, the address of your calendar account")
+		}
+	default:
+		log.Fatalf("Unknown INVITATION_MODE: %s", InvitationMode)
+	}
+	log.Printf("Invitation mode: %s", InvitationMode)
+}
+
+// organizerAddress returns the owner's address used as the ORGANIZER of
+// events and invitations: OWNER_EMAIL, else SMTP_FROM, else nil
+func organizerAddress() *mail.Address {
+	for _, value := range []string{OwnerEmail, SMTPFrom} {
+		if addr, err := mail.ParseAddress(value); err == nil {
+			return addr
+		}
+	}
+	return nil
+}
+
+func organizerProp(addr *mail.Address) *ical.Prop {
+	org := ical.NewProp(ical.PropOrganizer)
+	org.Value = "mailto:" + addr.Address
+	if addr.Name != "" {
+		org.Params.Set(ical.ParamCommonName, paramValue(addr.Name))
+	}
+	return org
+}
+
+// setBookingAttendee makes the booker, when they left an email address,
+// and the guests ATTENDEEs asked to reply, and the owner the
+// ORGANIZER. Answers already given to the same addresses are kept. It
+// reports whether the booker was invited.
+func setBookingAttendee(event *ical.Component, record *Booking) bool {
+	statuses := attendeeStatuses(event)
+	event.Props.Del(ical.PropOrganizer)
+	event.Props.Del(ical.PropAttendee)
+
+	organizer := organizerAddress()
+	email := record.contact(channelEmail)
+	invited := email != ""
+	if organizer == nil || InvitationMode == invitationNone || (!invited && len(record.Guests) == 0) {
+		return false
+	}
+	event.Props.Set(organizerProp(organizer))
+
+	if invited {
+		event.Props.Add(newAttendee(email, record.FullName, statuses, paramBookingCode, record.Code))
+	}
+	for _, guest := range record.Guests {
+		// Guests get a copy without the cancellation code by email, even
+		// in caldav mode, where the server would send the stored event
+		attendee := newAttendee(guest, "", statuses, paramGuestOf, record.Code)
+		attendee.Params.Set(paramScheduleAgent, "CLIENT")
+		event.Props.Add(attendee)
+	}
+	return invited
+}
+
+// newAttendee builds an ATTENDEE marked with the booking code in param.
+// Outside of caldav mode it is marked SCHEDULE-AGENT=CLIENT so a
+// scheduling server does not send a second invitation.
+func newAttendee(address, name string, statuses map[string]string, param, code string) *ical.Prop {
+	attendee := ical.NewProp(ical.PropAttendee)
+	attendee.Value = "mailto:" + address
+	if name != "" {
+		attendee.Params.Set(ical.ParamCommonName, paramValue(name))
+	}
+	attendee.Params.Set(ical.ParamRole, "REQ-PARTICIPANT")
+	if status := statuses[strings.ToLower(address)]; status != "" && status != "NEEDS-ACTION" {
+		attendee.Params.Set(ical.ParamParticipationStatus, status)
+	} else {
+		attendee.Params.Set(ical.ParamParticipationStatus, "NEEDS-ACTION")
+		attendee.Params.Set(ical.ParamRSVP, "TRUE")
+	}
+	attendee.Params.Set(param, code)
+	if InvitationMode != invitationCalDAV {
+		attendee.Params.Set(paramScheduleAgent, "CLIENT")
+	}
+	return attendee
+}
+
+// emailsInvitation reports whether the booker's emails carry the
+// invitation. In caldav mode the server sends it for invited bookings, but
+// seats of group sessions are still sent by email.
+func emailsInvitation(b Booking) bool {
+	switch InvitationMode {
+	case invitationNone:
+		return false
+	case invitationCalDAV:
+		return !b.Invited
+	}
+	return true
+}
+
+// ReplyResponse is the result of processing an iTIP REPLY
+type ReplyResponse struct {
+	Success  bool   `json:"success"`
+	Code     string `json:"code,omitempty"`
+	PartStat string `json:"partstat,omitempty"`
+	Ignored  string `json:"ignored,omitempty"` // Why the reply changed nothing
+}
+
+// invitationReply processes an iTIP REPLY (RFC 5546) forwarded from the
+// owner's mailbox, such as the text/calendar part of an iMIP answer. The
+// booker declining cancels the booking, other answers and those of guests
+// are written to the attendee's PARTSTAT.
+func invitationReply(w http.ResponseWriter, r *http.Request) {
+	cal, err := ical.NewDecoder(io.LimitReader(r.Body, maxReplySize)).Decode()
+	if err != nil {
+		http.Error(w, "Invalid iCalendar data", http.StatusBadRequest)
+		return
+	}
+	if method, _ := cal.Props.Text(ical.PropMethod); !strings.EqualFold(method, "REPLY") {
+		http.Error(w, "Not an iTIP REPLY", http.StatusBadRequest)
+		return
+	}
+	event := calendarEvent(cal)
+	if event == nil || event.Props.Get(ical.PropAttendee) == nil {
+		http.Error(w, "The reply has no event or attendee", http.StatusBadRequest)
+		return
+	}
+
+	uid, _ := event.Props.Text(ical.PropUID)
+	record, exists := getBookingByInviteUID(uid)
+	if !exists {
+		http.Error(w, "Unknown booking", http.StatusNotFound)
+		return
+	}
+
+	attendee := event.Props.Get(ical.PropAttendee)
+	address := attendeeEmail(*attendee)
+	email := record.contact(channelEmail)
+	fromBooker := email != "" && strings.EqualFold(address, email)
+	if !fromBooker && !isGuest(record, address) {
+		audit("invitation_reply_rejected", map[string]string{"code": record.Code, "attendee": attendee.Value})
+		http.Error(w, "The reply is not from an attendee", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	response := ReplyResponse{Success: true, Code: record.Code}
+	partStat := strings.ToUpper(attendee.Params.Get(ical.ParamParticipationStatus))
+
+	if eventSequence(event) < record.Sequence {
+		// An answer to an invitation that was replaced since
+		response.Ignored = "outdated"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	switch partStat {
+	case "DECLINED":
+		if fromBooker {
+			err = cancelBooking(record, "Declined the invitation")
+		} else {
+			err = setAttendeeStatus(record, address, partStat)
+		}
+	case "ACCEPTED", "TENTATIVE":
+		err = setAttendeeStatus(record, address, partStat)
+	default:
+		http.Error(w, "Unsupported PARTSTAT", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error processing reply for %s: %v", record.Code, err)
+		http.Error(w, "Could not update the booking", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("%s answered %s for booking %s", address, partStat, record.Code)
+	audit("invitation_reply", map[string]string{"code": record.Code, "attendee": address, "partstat": partStat})
+	response.PartStat = partStat
+	json.NewEncoder(w).Encode(response)
+}
+
+// setAttendeeStatus writes an answer to the ATTENDEE with the address
+func setAttendeeStatus(record *Booking, address, partStat string) error {
+	ctx := context.Background()
+
+	cal, err := backend.FindByUID(ctx, record.UID)
+	if err != nil {
+		return err
+	}
+	event := calendarEvent(cal)
+	if event == nil {
+		return fmt.Errorf("calendar object %s has no event", record.UID)
+	}
+
+	attendees := event.Props.Values(ical.PropAttendee)
+	for i := range attendees {
+		if attendeeEmail(attendees[i]) == address {
+			attendees[i].Params.Set(ical.ParamParticipationStatus, partStat)
+			attendees[i].Params.Del(ical.ParamRSVP)
+			return backend.UpdateEvent(ctx, cal)
+		}
+	}
+	// Bookings made before attendees were written have nothing to update
+	return nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/rand"
+	"log"
+	"net/url"
+	"strings"
+
+	"github.com/emersion/go-ical"
+)
+
+// Location modes of a meeting type
+const (
+	locationInPerson = "in_person"
+	locationPhone    = "phone"
+	locationVideo    = "video"
+)
+
+var (
+	DefaultLocationMode = getEnvStr("MEETING_LOCATION_MODE", "") // in_person, phone or video without a meeting types file
+	DefaultLocation     = getEnvStr("MEETING_LOCATION", "")      // Address or video link without a meeting types file
+)
+
+// MeetingLocation says where meetings of a type take place
+type MeetingLocation struct {
+	Mode    string `json:"mode"`              // in_person, phone or video
+	Address string `json:"address,omitempty"` // Address of in-person meetings
+	URL     string `json:"url,omitempty"`     // Video link, {room} becomes a random room name per event
+}
+
+// checkLocation validates the location of a meeting type at start
+func checkLocation(t *MeetingType) {
+	l := t.Location
+	if l == nil || l.Mode == "" {
+		t.Location = nil
+		return
+	}
+
+	switch l.Mode {
+	case locationInPerson:
+		if l.Address == "" {
+			log.Fatalf("Meeting type %s: in_person locations need an address", t.ID)
+		}
+	case locationPhone:
+		if t.Seats > 1 {
+			log.Fatalf("Meeting type %s: group sessions cannot be phone calls", t.ID)
+		}
+	case locationVideo:
+		u, err := url.Parse(strings.ReplaceAll(l.URL, "{room}", "room"))
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			log.Fatalf("Meeting type %s: video locations need an http(s) url", t.ID)
+		}
+	default:
+		log.Fatalf("Meeting type %s: unknown location mode %q", t.ID, l.Mode)
+	}
+}
+
+// defaultLocation builds the location of the default meeting type from
+// MEETING_LOCATION_MODE and MEETING_LOCATION
+func defaultLocation() *MeetingLocation {
+	switch DefaultLocationMode {
+	case "":
+		return nil
+	case locationVideo:
+		return &MeetingLocation{Mode: DefaultLocationMode, URL: DefaultLocation}
+	}
+	return &MeetingLocation{Mode: DefaultLocationMode, Address: DefaultLocation}
+}
+
+// bookingLocation works out the LOCATION text and video link of a new
+// booking, or an error message for the booker
+func bookingLocation(t MeetingType, phone string) (string, string, string) {
+	if t.Location == nil {
+		return "", "", ""
+	}
+
+	switch t.Location.Mode {
+	case locationInPerson:
+		return t.Location.Address, "", ""
+	case locationPhone:
+		number, ok := validPhone(phone)
+		if !ok {
+			return "", "", "A valid phone number is required"
+		}
+		return "Phone: " + number, "", ""
+	}
+
+	link := strings.ReplaceAll(t.Location.URL, "{room}", newRoomName())
+	return link, link, ""
+}
+
+// newRoomName returns a random video room name. It is not derived from
+// the cancellation code, so the link can be shared without the code.
+func newRoomName() string {
+	const alphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatalf("Error generating room name: %v", err)
+	}
+	for i, b := range buf {
+		buf[i] = alphabet[int(b)%len(alphabet)]
+	}
+	return "bookmymeet-" + string(buf)
+}
+
+// validPhone strips the usual separators from a phone number and checks
+// that 5 to 15 digits remain, with an optional leading +
+func validPhone(phone string) (string, bool) {
+	var number strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			number.WriteRune(r)
+		case r == '+' && i == 0:
+			number.WriteRune(r)
+		case strings.ContainsRune(" -./()", r):
+		default:
+			return "", false
+		}
+	}
+
+	digits := len(strings.TrimPrefix(number.String(), "+"))
+	return number.String(), digits >= 5 && digits <= 15
+}
+
+// setEventLocation writes LOCATION and, for video meetings, the URL and
+// CONFERENCE (RFC 7986) properties
+func setEventLocation(event *ical.Component, location, videoURL string) {
+	if location == "" {
+		return
+	}
+	event.Props.SetText(ical.PropLocation, location)
+	if videoURL == "" {
+		return
+	}
+
+	link := ical.NewProp(ical.PropURL)
+	link.SetValueType(ical.ValueURI)
+	link.Value = videoURL
+	event.Props.Set(link)
+
+	// RFC 7986 wants VALUE=URI spelled out even though it is the default
+	conference := ical.NewProp(ical.PropConference)
+	conference.Params.Set(ical.ParamValue, string(ical.ValueURI))
+	conference.Params["FEATURE"] = []string{"AUDIO", "VIDEO"}
+	conference.Params.Set("LABEL", "Video call")
+	conference.Value = videoURL
+	event.Props.Set(conference)
+}
+
+// eventLocation reads back what setEventLocation wrote
+func eventLocation(event *ical.Component) (string, string) {
+	location, _ := event.Props.Text(ical.PropLocation)
+	videoURL := ""
+	if conference := event.Props.Get(ical.PropConference); conference != nil {
+		videoURL = conference.Value
+	}
+	return location, videoURL
+}
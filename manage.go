@@ -0,0 +1,279 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/gorilla/mux"
+)
+
+var (
+	BookingLinkSecret = getEnvSecret("BOOKING_LINK_SECRET", "")            // Key signing management links
+	BaseURL           = strings.TrimSuffix(getEnvStr("BASE_URL", ""), "/") // Public URL of the service, used in links
+
+	bookingLinkKey []byte
+)
+
+// ManageRequest carries the changes made on the management page
+type ManageRequest struct {
+	Date        string            `json:"date,omitempty"`
+	Time        string            `json:"time,omitempty"`
+	FullName    string            `json:"fullName,omitempty"`
+	ContactInfo string            `json:"contactInfo,omitempty"`
+	Contacts    map[string]string `json:"contacts,omitempty"`
+	Reason      string            `json:"reason,omitempty"`
+	CSRFToken   string            `json:"_csrf"`
+}
+
+// BookingDetails is the booking as shown on the management page
+type BookingDetails struct {
+	*Booking
+	MeetingTypeName string `json:"meetingTypeName"`
+}
+
+// initBookingLinks sets up the key for management links. Without a
+// configured secret a random key is used, so links stop working after a
+// restart.
+func initBookingLinks() {
+	if BookingLinkSecret != "" {
+		bookingLinkKey = []byte(BookingLinkSecret)
+		return
+	}
+
+	bookingLinkKey = make([]byte, 32)
+	if _, err := rand.Read(bookingLinkKey); err != nil {
+		log.Fatalf("Error generating booking link key: %v", err)
+	}
+	log.Printf("BOOKING_LINK_SECRET is not set, management links will not survive a restart")
+}
+
+// bookingToken signs a booking code for use in a management URL
+func bookingToken(code string) string {
+	mac := hmac.New(sha256.New, bookingLinkKey)
+	mac.Write([]byte(code))
+	return code + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyBookingToken returns the booking code of a correctly signed token
+func verifyBookingToken(token string) (string, bool) {
+	code, _, found := strings.Cut(token, ".")
+	if !found || code == "" {
+		return "", false
+	}
+	return code, hmac.Equal([]byte(bookingToken(code)), []byte(token))
+}
+
+// manageURL returns the management page of a booking
+func manageURL(code string) string {
+	return BaseURL + "/booking/" + bookingToken(code)
+}
+
+// registerManageRoutes adds the management page and its API
+func registerManageRoutes(r *mux.Router) {
+	r.HandleFunc("/booking/{token}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "./static/manage.html")
+	}).Methods("GET")
+
+	r.HandleFunc("/api/booking/{token}", manageDetails).Methods("GET")
+	r.HandleFunc("/api/booking/{token}/ics", manageICS).Methods("GET")
+	r.HandleFunc("/api/booking/{token}/cancel", manageCancel).Methods("POST")
+	r.HandleFunc("/api/booking/{token}/reschedule", manageReschedule).Methods("POST")
+	r.HandleFunc("/api/booking/{token}/contact", manageContact).Methods("POST")
+}
+
+// bookingFromToken looks up the booking of the token in the request path.
+// Bad signatures count against the client like wrong booking codes.
+func bookingFromToken(r *http.Request) (*Booking, bool) {
+	ipKey := "ip:" + clientIP(r)
+	if codeAttempts.Locked(ipKey) {
+		audit("code_locked_out", map[string]string{"ip": clientIP(r), "action": "manage"})
+		return nil, false
+	}
+
+	code, ok := verifyBookingToken(mux.Vars(r)["token"])
+	if !ok {
+		codeAttempts.Fail(ipKey)
+		audit("token_attempt_failed", map[string]string{"ip": clientIP(r), "action": "manage"})
+		return nil, false
+	}
+	return getBooking(code)
+}
+
+// decodeManageRequest reads the request body and checks the CSRF token,
+// writing the error response itself
+func decodeManageRequest(w http.ResponseWriter, r *http.Request) (*Booking, ManageRequest, bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var req ManageRequest
+	clientToken := r.Header.Get("X-CSRF-Token")
+	if clientToken == "" {
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: "CSRF token missing"})
+		return nil, req, false
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: "Invalid data format"})
+		return nil, req, false
+	}
+	if req.CSRFToken != clientToken {
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: "Invalid CSRF token"})
+		return nil, req, false
+	}
+
+	record, exists := bookingFromToken(r)
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: "Booking not found"})
+		return nil, req, false
+	}
+	return record, req, true
+}
+
+func manageDetails(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	record, exists := bookingFromToken(r)
+	if !exists {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: "Booking not found"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(BookingDetails{Booking: record, MeetingTypeName: meetingTypeName(record.MeetingType)})
+}
+
+func manageICS(w http.ResponseWriter, r *http.Request) {
+	record, exists := bookingFromToken(r)
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	cal, err := bookingCalendar(record)
+	if err != nil {
+		log.Printf("Error building calendar for %s: %v", record.Code, err)
+		http.Error(w, "Server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="booking-%s.ics"`, record.Code))
+	if err := ical.NewEncoder(w).Encode(cal); err != nil {
+		log.Printf("Error encoding calendar for %s: %v", record.Code, err)
+	}
+}
+
+func manageCancel(w http.ResponseWriter, r *http.Request) {
+	record, req, ok := decodeManageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if message := cancelNoticeError(record); message != "" {
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: message})
+		return
+	}
+
+	log.Printf("Cancelling booking from management page: %s", record.Code)
+	if err := cancelBooking(record, req.Reason); err != nil {
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: "Cancellation error"})
+		return
+	}
+	json.NewEncoder(w).Encode(BookingResponse{Success: true})
+}
+
+func manageReschedule(w http.ResponseWriter, r *http.Request) {
+	record, req, ok := decodeManageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if message := rescheduleNoticeError(record); message != "" {
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: message})
+		return
+	}
+
+	if err := rescheduleBooking(record, req.Date, req.Time); err != nil {
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: "Reschedule error: " + err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(BookingResponse{Success: true, Code: record.Code})
+}
+
+func manageContact(w http.ResponseWriter, r *http.Request) {
+	record, req, ok := decodeManageRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if req.FullName == "" {
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: "All fields are required"})
+		return
+	}
+	contacts, contactsError := checkContacts(req.Contacts, req.ContactInfo)
+	if contactsError != "" {
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: contactsError})
+		return
+	}
+
+	if err := updateBookingContact(record, req.FullName, contacts); err != nil {
+		log.Printf("Error updating contact of %s: %v", record.Code, err)
+		json.NewEncoder(w).Encode(BookingResponse{Success: false, Error: "Update error"})
+		return
+	}
+	json.NewEncoder(w).Encode(BookingResponse{Success: true, Code: record.Code})
+}
+
+// updateBookingContact changes who booked and how to reach them, both in
+// the stored booking and in the calendar event
+func updateBookingContact(record *Booking, fullName string, contacts []Contact) error {
+	updated := *record
+	updated.FullName = fullName
+	updated.Contacts, updated.ContactInfo = contacts, contactSummary(contacts)
+
+	var err error
+	if record.Seat {
+		err = updateSeat(&updated)
+	} else {
+		err = updateBookingDescription(&updated)
+	}
+	if err != nil {
+		return err
+	}
+
+	saveBooking(&updated)
+	return nil
+}
+
+// bookingCalendar builds a calendar object for the booker holding only
+// their own booking, not the attendees of a group session. Its UID is the
+// booking's invitation UID, so it stays the same when a seat moves to
+// another session.
+func bookingCalendar(record *Booking) (*ical.Calendar, error) {
+	start, err := time.Parse("2006-01-02 15:04", record.Date+" "+record.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	// A seat's invitation carries the summary of its group session
+	summary := record.Topic
+	if record.Seat {
+		if summary, _, err = eventTexts(*record); err != nil {
+			return nil, err
+		}
+	}
+
+	cal, event := newEventCalendar(record.inviteUID(), start, time.Duration(record.Duration)*time.Minute, summary)
+	event.Props.SetText(ical.PropDescription, "Manage your booking: "+manageURL(record.Code))
+	setEventLocation(event, record.Location, record.VideoURL)
+	setSequence(event, record.Sequence)
+	return cal, nil
+}
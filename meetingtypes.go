@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	MeetingTypesFile = getEnvStr("MEETING_TYPES_FILE", "")       // JSON file with meeting types
+	MeetingDurations = getEnvStrSlice("MEETING_DURATIONS", "60") // Allowed durations in minutes without a meeting types file
+	MeetingSeats     = getEnvInt("MEETING_SEATS", 1)             // Attendees per slot without a meeting types file
+	SlotStep         = getEnvInt("SLOT_STEP", 60)                // Minutes between offered start times
+
+	meetingTypes []MeetingType
+)
+
+// MeetingType is a kind of meeting with its own set of allowed durations
+type MeetingType struct {
+	ID              string `json:"id"`
+	Name            string `json:"name"`
+	Durations       []int  `json:"durations"`       // Allowed durations in minutes
+	DefaultDuration int    `json:"defaultDuration"` // Preselected duration, the first one if unset
+	Seats           int    `json:"seats"`           // Attendees per slot, more than one makes it a group session
+
+	Location  *MeetingLocation `json:"location,omitempty"`  // Where meetings take place, unset if not stated
+	Questions []Question       `json:"questions,omitempty"` // Extra fields of the booking form
+}
+
+// Allows reports whether the duration in minutes can be booked
+func (t MeetingType) Allows(minutes int) bool {
+	for _, duration := range t.Durations {
+		if duration == minutes {
+			return true
+		}
+	}
+	return false
+}
+
+// initMeetingTypes loads MEETING_TYPES_FILE, or builds a single default
+// type from MEETING_DURATIONS
+func initMeetingTypes() {
+	if SlotStep <= 0 {
+		log.Fatalf("SLOT_STEP must be positive")
+	}
+
+	if MeetingTypesFile != "" {
+		data, err := os.ReadFile(MeetingTypesFile)
+		if err != nil {
+			log.Fatalf("Error reading MEETING_TYPES_FILE: %v", err)
+		}
+		if err := json.Unmarshal(data, &meetingTypes); err != nil {
+			log.Fatalf("Error parsing MEETING_TYPES_FILE: %v", err)
+		}
+	} else {
+		defaultType := MeetingType{ID: "default", Name: "Meeting", Seats: MeetingSeats, Location: defaultLocation()}
+		for _, value := range MeetingDurations {
+			minutes, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				log.Fatalf("Error parsing MEETING_DURATIONS: %v", err)
+			}
+			defaultType.Durations = append(defaultType.Durations, minutes)
+		}
+		meetingTypes = []MeetingType{defaultType}
+	}
+
+	if len(meetingTypes) == 0 {
+		log.Fatalf("At least one meeting type is required")
+	}
+
+	seen := make(map[string]bool)
+	for i := range meetingTypes {
+		t := &meetingTypes[i]
+		if t.ID == "" || seen[t.ID] {
+			log.Fatalf("Meeting type %d needs a unique id", i+1)
+		}
+		seen[t.ID] = true
+
+		if t.Name == "" {
+			t.Name = t.ID
+		}
+		if len(t.Durations) == 0 {
+			log.Fatalf("Meeting type %s has no durations", t.ID)
+		}
+		for _, duration := range t.Durations {
+			if duration <= 0 {
+				log.Fatalf("Meeting type %s has an invalid duration: %d", t.ID, duration)
+			}
+		}
+		if t.Seats == 0 {
+			t.Seats = 1
+		}
+		if t.Seats < 0 {
+			log.Fatalf("Meeting type %s has an invalid number of seats: %d", t.ID, t.Seats)
+		}
+		if t.DefaultDuration == 0 {
+			t.DefaultDuration = t.Durations[0]
+		}
+		if !t.Allows(t.DefaultDuration) {
+			log.Fatalf("Meeting type %s: default duration %d is not allowed", t.ID, t.DefaultDuration)
+		}
+		checkLocation(t)
+		checkQuestions(t)
+	}
+
+	log.Printf("Meeting types configured: %d", len(meetingTypes))
+}
+
+// findMeetingType returns the meeting type with the ID, or the first one
+// when the ID is empty
+func findMeetingType(id string) (MeetingType, bool) {
+	if id == "" {
+		return meetingTypes[0], true
+	}
+	for _, t := range meetingTypes {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return MeetingType{}, false
+}
+
+// meetingTypeName returns the display name of a meeting type, or the ID
+// when the type is no longer configured
+func meetingTypeName(id string) string {
+	if t, ok := findMeetingType(id); ok {
+		return t.Name
+	}
+	return id
+}
+
+// resolveDuration checks the requested meeting type and duration in
+// minutes, falling back to the type's default duration
+func resolveDuration(typeID string, minutes int) (MeetingType, time.Duration, error) {
+	t, ok := findMeetingType(typeID)
+	if !ok {
+		return MeetingType{}, 0, fmt.Errorf("unknown meeting type")
+	}
+	if minutes == 0 {
+		minutes = t.DefaultDuration
+	}
+	if !t.Allows(minutes) {
+		return MeetingType{}, 0, fmt.Errorf("duration not allowed for this meeting type")
+	}
+	return t, time.Duration(minutes) * time.Minute, nil
+}
+
+func meetingTypesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// Video links are only handed out with a booking, and questions come
+	// from /api/form-schema
+	public := make([]MeetingType, len(meetingTypes))
+	for i, t := range meetingTypes {
+		public[i] = t
+		public[i].Questions = nil
+		if t.Location != nil {
+			public[i].Location = &MeetingLocation{Mode: t.Location.Mode, Address: t.Location.Address}
+		}
+	}
+	if err := json.NewEncoder(w).Encode(public); err != nil {
+		log.Printf("JSON encoding error: %v", err)
+	}
+}
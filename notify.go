@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Events a notification can be about
+const (
+	notifyConfirmed      = "confirmed"
+	notifyRescheduled    = "rescheduled"
+	notifyCancelled      = "cancelled"
+	notifyOwnerCancelled = "cancelled_by_owner"
+	notifyMoved          = "moved"
+	notifyDeclined       = "declined"
+	notifyReminder       = "reminder"
+)
+
+// Notification tells the owner or the booker that something happened to
+// a booking
+type Notification struct {
+	Event   string
+	Owner   bool // For the calendar owner rather than the booker
+	Booking Booking
+	Reason  string // Optional explanation, such as a cancellation reason
+}
+
+// Notifier delivers notifications through one channel
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+var (
+	notifiers     []Notifier
+	ownerLocation *time.Location // OWNER_TIMEZONE
+)
+
+// initNotifiers sets up the configured notification channels
+func initNotifiers() {
+	var err error
+	if ownerLocation, err = time.LoadLocation(OwnerTimezone); err != nil {
+		log.Fatalf("Invalid OWNER_TIMEZONE: %v", err)
+	}
+
+	notifiers = []Notifier{logNotifier{}}
+	if SMTPHost != "" {
+		notifiers = append(notifiers, newSMTPNotifier())
+	}
+	for _, push := range loadPushNotifiers() {
+		notifiers = append(notifiers, push)
+	}
+}
+
+// notify hands the notification to every notifier in the background so
+// that a slow channel does not delay the response
+func notify(n Notification) {
+	for _, notifier := range notifiers {
+		go func(notifier Notifier) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := notifier.Notify(ctx, n); err != nil {
+				log.Printf("Error sending %s notification for %s: %v", n.Event, n.Booking.Code, err)
+			}
+		}(notifier)
+	}
+}
+
+// logNotifier writes notifications to the log
+type logNotifier struct{}
+
+func (logNotifier) Notify(ctx context.Context, n Notification) error {
+	recipient := "booker " + n.Booking.ContactInfo
+	if n.Owner {
+		recipient = "owner"
+	}
+
+	if n.Reason != "" {
+		log.Printf("Notify %s: booking %s on %s %s %s, reason: %q", recipient, n.Booking.Code,
+			n.Booking.Date, n.Booking.Time, n.Event, n.Reason)
+		return nil
+	}
+	log.Printf("Notify %s: booking %s on %s %s %s", recipient, n.Booking.Code,
+		n.Booking.Date, n.Booking.Time, n.Event)
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PushNotifier posts notifications for the owner to a chat or push
+// service. Which notifications it gets is decided by its event and
+// meeting type routing lists.
+type PushNotifier struct {
+	Name         string
+	Type         string // http, ntfy, gotify, matrix or telegram
+	URL          string
+	Token        string
+	Target       string   // ntfy topic, Matrix room ID or Telegram chat ID
+	Events       []string // Notification events to send, all if empty
+	MeetingTypes []string // Meeting type IDs to send, all if empty
+
+	body        *template.Template // Request body of the http type
+	contentType string
+	client      *http.Client
+}
+
+// PushMessage is the data the body template of an http notifier gets
+type PushMessage struct {
+	MessageData
+	Text string // Rendered push.txt
+}
+
+// Default URLs of the hosted services
+var pushDefaultURLs = map[string]string{
+	"ntfy":     "https://ntfy.sh",
+	"telegram": "https://api.telegram.org",
+}
+
+// loadPushNotifiers reads NOTIFIER_<N>_* variables starting at N=1 until
+// the first missing TYPE
+func loadPushNotifiers() []*PushNotifier {
+	var pushers []*PushNotifier
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("NOTIFIER_%d_", i)
+		kind := strings.ToLower(getEnvStr(prefix+"TYPE", ""))
+		if kind == "" {
+			break
+		}
+
+		p := &PushNotifier{
+			Name:         getEnvStr(prefix+"NAME", fmt.Sprintf("%s-%d", kind, i)),
+			Type:         kind,
+			URL:          strings.TrimSuffix(getEnvStr(prefix+"URL", pushDefaultURLs[kind]), "/"),
+			Token:        getEnvSecret(prefix+"TOKEN", ""),
+			Target:       getEnvStr(prefix+"TARGET", ""),
+			Events:       trimmedList(getEnvStrSlice(prefix+"EVENTS", "")),
+			MeetingTypes: trimmedList(getEnvStrSlice(prefix+"MEETING_TYPES", "")),
+			contentType:  getEnvStr(prefix+"CONTENT_TYPE", "application/json"),
+			client:       &http.Client{Timeout: 15 * time.Second},
+		}
+
+		for _, event := range p.Events {
+			if _, ok := emailKinds[event]; !ok {
+				log.Fatalf("Unknown event in %sEVENTS: %s", prefix, event)
+			}
+			if event == notifyReminder && !ReminderOwner {
+				log.Fatalf("%sEVENTS lists reminder, which only reaches notifiers with REMINDER_OWNER=true", prefix)
+			}
+		}
+
+		switch kind {
+		case "http":
+		case "ntfy":
+			if p.Target == "" {
+				log.Fatalf("%sTARGET (the topic) is required for ntfy notifiers", prefix)
+			}
+		case "gotify":
+			if p.Token == "" {
+				log.Fatalf("%sTOKEN (an application token) is required for gotify notifiers", prefix)
+			}
+		case "matrix", "telegram":
+			if p.Target == "" || p.Token == "" {
+				log.Fatalf("%sTARGET and %sTOKEN are required for %s notifiers", prefix, prefix, kind)
+			}
+		default:
+			log.Fatalf("Unknown %sTYPE: %s", prefix, kind)
+		}
+		if p.URL == "" {
+			log.Fatalf("%sURL is required for %s notifiers", prefix, kind)
+		}
+
+		if text := getEnvStr(prefix+"TEMPLATE", ""); text != "" {
+			t, err := template.New(p.Name).Funcs(template.FuncMap{"json": jsonString}).Parse(text)
+			if err != nil {
+				log.Fatalf("Invalid %sTEMPLATE: %v", prefix, err)
+			}
+			p.body = t
+		}
+
+		log.Printf("Sending %s notifications to %s", kind, p.Name)
+		pushers = append(pushers, p)
+	}
+	return pushers
+}
+
+func trimmedList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// jsonString quotes a value for use inside a JSON body template
+func jsonString(v any) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// routes reports whether the notification matches the routing lists
+func (p *PushNotifier) routes(n Notification) bool {
+	matches := func(list []string, value string) bool {
+		if len(list) == 0 {
+			return true
+		}
+		for _, v := range list {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	return matches(p.Events, n.Event) && matches(p.MeetingTypes, n.Booking.MeetingType)
+}
+
+func (p *PushNotifier) Notify(ctx context.Context, n Notification) error {
+	if !n.Owner || !p.routes(n) {
+		return nil
+	}
+
+	title, text, data, err := renderPush(n)
+	if err != nil {
+		return err
+	}
+
+	switch p.Type {
+	case "ntfy":
+		return p.post(ctx, http.MethodPost, p.URL+"/"+url.PathEscape(p.Target), "text/plain; charset=utf-8", []byte(text), map[string]string{
+			"Title":         mime.QEncoding.Encode("utf-8", title),
+			"Tags":          "calendar",
+			"Authorization": bearer(p.Token),
+		})
+	case "gotify":
+		body, _ := json.Marshal(map[string]any{"title": title, "message": text, "priority": 5})
+		return p.post(ctx, http.MethodPost, p.URL+"/message", "application/json", body, map[string]string{
+			"X-Gotify-Key": p.Token,
+		})
+	case "matrix":
+		body, _ := json.Marshal(map[string]string{"msgtype": "m.text", "body": title + "\n" + text})
+		endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+			p.URL, url.PathEscape(p.Target), uuid.New().String())
+		return p.post(ctx, http.MethodPut, endpoint, "application/json", body, map[string]string{
+			"Authorization": bearer(p.Token),
+		})
+	case "telegram":
+		body, _ := json.Marshal(map[string]string{"chat_id": p.Target, "text": title + "\n" + text})
+		return p.post(ctx, http.MethodPost, p.URL+"/bot"+p.Token+"/sendMessage", "application/json", body, nil)
+	}
+
+	var body []byte
+	if p.body != nil {
+		var buf bytes.Buffer
+		if err := p.body.Execute(&buf, PushMessage{MessageData: data, Text: text}); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	} else {
+		body, _ = json.Marshal(map[string]any{
+			"event": n.Event, "title": title, "message": text,
+			"code": n.Booking.Code, "meetingType": n.Booking.MeetingType,
+			"start": data.Start.UTC(), "end": data.End.UTC(),
+		})
+	}
+	return p.post(ctx, http.MethodPost, p.URL, p.contentType, body, map[string]string{
+		"Authorization": bearer(p.Token),
+	})
+}
+
+// renderPush renders the title and text of a push message for the owner.
+// The title uses the owner's subject templates, the text push.txt.
+func renderPush(n Notification) (string, string, MessageData, error) {
+	kind := emailKinds[n.Event]
+	data := messageData(n.Booking, n.Event, ownerLocation)
+	data.Reason = n.Reason
+	data.Title, data.Intro = kind.ownerSubject, kind.ownerIntro
+
+	title, err := renderText([]string{"owner-" + n.Event + ".subject.txt", "owner-subject.txt"}, OwnerLanguage, data)
+	if err != nil {
+		return "", "", data, err
+	}
+	text, err := renderText([]string{"push-" + n.Event + ".txt", "push.txt"}, OwnerLanguage, data)
+	if err != nil {
+		return "", "", data, err
+	}
+	return strings.Join(strings.Fields(title), " "), strings.TrimSpace(text), data, nil
+}
+
+func bearer(token string) string {
+	if token == "" {
+		return ""
+	}
+	return "Bearer " + token
+}
+
+// post sends one request and treats any status but 2xx as an error
+func (p *PushNotifier) post(ctx context.Context, method, endpoint, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		if value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil && p.Type == "telegram" {
+		// The error holds the URL, which holds the bot token
+		return fmt.Errorf("%s: request failed", p.Name)
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("%s: status %d: %s", p.Name, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/emersion/go-ical"
+)
+
+// Question types of the booking form
+const (
+	questionText     = "text"
+	questionTextarea = "textarea"
+	questionSelect   = "select"
+	questionCheckbox = "checkbox"
+	questionEmail    = "email"
+	questionPhone    = "phone"
+)
+
+// Default length limits of text answers
+const (
+	maxTextAnswer     = 200
+	maxTextareaAnswer = 2000
+)
+
+// propAnswer holds the answer to a question in the event, with the
+// question ID in paramQuestion and the booking code in paramBookingCode
+const (
+	propAnswer    = "X-BOOKMYMEET-ANSWER"
+	paramQuestion = "X-QUESTION"
+)
+
+var questionIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// Question is an extra field of the booking form of a meeting type
+type Question struct {
+	ID        string   `json:"id"` // Lowercase letters, digits and dashes
+	Label     string   `json:"label"`
+	Type      string   `json:"type"` // text, textarea, select, checkbox, email or phone
+	Required  bool     `json:"required,omitempty"`
+	Options   []string `json:"options,omitempty"`   // Choices of a select
+	MaxLength int      `json:"maxLength,omitempty"` // Characters of a text or textarea answer
+	Help      string   `json:"help,omitempty"`      // Hint shown with the field
+}
+
+// Answer is a checked answer as stored with a booking
+type Answer struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Value string `json:"value"` // "yes" or "no" for checkboxes
+}
+
+// FormSchema describes the booking form of a meeting type
+type FormSchema struct {
+	MeetingType string           `json:"meetingType"`
+	Questions   []Question       `json:"questions"`
+	Contacts    []ContactChannel `json:"contacts"` // Contact fields, the same for every type
+}
+
+// checkQuestions validates the questions of a meeting type at start
+func checkQuestions(t *MeetingType) {
+	seen := make(map[string]bool)
+	for i := range t.Questions {
+		q := &t.Questions[i]
+		if !questionIDPattern.MatchString(q.ID) || seen[q.ID] {
+			log.Fatalf("Meeting type %s: question %d needs a unique id of lowercase letters, digits and dashes", t.ID, i+1)
+		}
+		seen[q.ID] = true
+
+		if q.Label == "" {
+			q.Label = q.ID
+		}
+		switch q.Type {
+		case questionText, questionTextarea:
+			if q.MaxLength <= 0 {
+				q.MaxLength = maxTextAnswer
+				if q.Type == questionTextarea {
+					q.MaxLength = maxTextareaAnswer
+				}
+			}
+		case questionSelect:
+			if len(q.Options) == 0 {
+				log.Fatalf("Meeting type %s: select question %s has no options", t.ID, q.ID)
+			}
+		case questionCheckbox, questionEmail, questionPhone:
+		default:
+			log.Fatalf("Meeting type %s: question %s has unknown type %q", t.ID, q.ID, q.Type)
+		}
+	}
+}
+
+// checkAnswers validates the answers of a booking request against the
+// questions of the meeting type. It returns the answers in question order,
+// or an error message for the booker.
+func checkAnswers(t MeetingType, answers map[string]any) ([]Answer, string) {
+	for id := range answers {
+		if !slices.ContainsFunc(t.Questions, func(q Question) bool { return q.ID == id }) {
+			return nil, fmt.Sprintf("Unknown question: %s", id)
+		}
+	}
+
+	var checked []Answer
+	for _, q := range t.Questions {
+		value, err := answerValue(q, answers[q.ID])
+		if err != "" {
+			return nil, err
+		}
+		if value == "" || (q.Type == questionCheckbox && value == "no") {
+			if q.Required {
+				return nil, fmt.Sprintf("Please answer: %s", q.Label)
+			}
+			if value == "" {
+				continue
+			}
+		}
+		checked = append(checked, Answer{ID: q.ID, Label: q.Label, Value: value})
+	}
+	return checked, ""
+}
+
+// answerValue checks and normalizes one answer, empty when unanswered
+func answerValue(q Question, raw any) (string, string) {
+	invalid := fmt.Sprintf("Invalid answer: %s", q.Label)
+
+	if q.Type == questionCheckbox {
+		switch v := raw.(type) {
+		case nil:
+			return "no", ""
+		case bool:
+			if v {
+				return "yes", ""
+			}
+			return "no", ""
+		}
+		return "", invalid
+	}
+
+	if raw == nil {
+		return "", ""
+	}
+	text, ok := raw.(string)
+	if !ok {
+		return "", invalid
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", ""
+	}
+
+	switch q.Type {
+	case questionText:
+		if strings.ContainsAny(text, "\r\n") || len([]rune(text)) > q.MaxLength {
+			return "", invalid
+		}
+	case questionTextarea:
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+		if len([]rune(text)) > q.MaxLength {
+			return "", invalid
+		}
+	case questionSelect:
+		if !slices.Contains(q.Options, text) {
+			return "", invalid
+		}
+	case questionEmail:
+		addr, err := mail.ParseAddress(text)
+		if err != nil {
+			return "", invalid
+		}
+		text = addr.Address
+	case questionPhone:
+		number, ok := validPhone(text)
+		if !ok {
+			return "", invalid
+		}
+		text = number
+	}
+	return text, ""
+}
+
+// setAnswerProps writes the answers of a booking as X-BOOKMYMEET-ANSWER
+// properties, replacing those written for the booking before
+func setAnswerProps(event *ical.Component, record *Booking) {
+	removeBookingProps(event, propAnswer, record.Code)
+	for _, answer := range record.Answers {
+		prop := ical.NewProp(propAnswer)
+		prop.Params.Set(paramQuestion, answer.ID)
+		prop.Params.Set(paramBookingCode, record.Code)
+		prop.SetText(answer.Value)
+		event.Props.Add(prop)
+	}
+}
+
+// removeBookingProps drops the properties of a name written for a booking
+func removeBookingProps(event *ical.Component, name, code string) {
+	var kept []ical.Prop
+	for _, prop := range event.Props.Values(name) {
+		if prop.Params.Get(paramBookingCode) != code {
+			kept = append(kept, prop)
+		}
+	}
+	if len(kept) > 0 {
+		event.Props[name] = kept
+	} else {
+		event.Props.Del(name)
+	}
+}
+
+// formSchema serves the questions of a meeting type, selected by the type
+// parameter like /api/available, and the contact fields
+func formSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	t, ok := findMeetingType(r.URL.Query().Get("type"))
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Unknown meeting type"})
+		return
+	}
+
+	schema := FormSchema{MeetingType: t.ID, Questions: t.Questions, Contacts: enabledContactChannels()}
+	if schema.Questions == nil {
+		schema.Questions = []Question{}
+	}
+	if err := json.NewEncoder(w).Encode(schema); err != nil {
+		log.Printf("JSON encoding error: %v", err)
+	}
+}
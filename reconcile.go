@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+var ReconcileInterval = getEnvInt("RECONCILE_INTERVAL", 15) // Minutes between checks of bookings against the calendar, 0 disables
+
+// initReconciliation starts the periodic check of stored bookings against
+// the calendar, which notices events the owner changed in their own
+// calendar app
+func initReconciliation() {
+	if ReconcileInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(ReconcileInterval) * time.Minute)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			reconcileBookings(context.Background())
+		}
+	}()
+}
+
+// reconcileBookings compares every upcoming booking with its calendar
+// event, forgets bookings whose event was deleted, cancelled or declined,
+// follows events that were moved, and tells the booker and the owner
+// about it
+func reconcileBookings(ctx context.Context) {
+	now := time.Now().UTC()
+	for _, record := range listBookings() {
+		start, err := time.Parse("2006-01-02 15:04", record.Date+" "+record.Time)
+		if err != nil || start.Before(now) {
+			continue
+		}
+
+		cal, err := backend.FindByUID(ctx, record.UID)
+		if errors.Is(err, ErrEventNotFound) {
+			dropBooking(record, notifyOwnerCancelled, "the event was removed from the calendar")
+			continue
+		}
+		if err != nil {
+			log.Printf("Error checking booking %s: %v", record.Code, err)
+			continue
+		}
+
+		event := calendarEvent(cal)
+		if event == nil {
+			dropBooking(record, notifyOwnerCancelled, "the event was removed from the calendar")
+			continue
+		}
+		reconcileEvent(record, event)
+	}
+}
+
+// reconcileEvent updates one booking from the current state of its event.
+// The booking was copied before the event was fetched, so a change the
+// booker made meanwhile wins over the calendar.
+func reconcileEvent(record Booking, event *ical.Component) {
+	if !isCurrentBooking(record) {
+		return
+	}
+
+	if status, _ := event.Props.Text(ical.PropStatus); strings.EqualFold(status, "CANCELLED") {
+		dropBooking(record, notifyOwnerCancelled, "the event was cancelled")
+		return
+	}
+
+	attendee, found := bookingAttendee(event, record.Code)
+	if record.Seat && !found {
+		dropBooking(record, notifyOwnerCancelled, "the seat was removed from the session")
+		return
+	}
+	if found && strings.EqualFold(attendee.Params.Get(ical.ParamParticipationStatus), "DECLINED") {
+		if record.Invited {
+			// The server applied the booker's own REPLY
+			log.Printf("Booker declined the invitation for %s", record.Code)
+			if err := cancelBooking(&record, "Declined the invitation"); err != nil {
+				log.Printf("Error cancelling declined booking %s: %v", record.Code, err)
+			}
+			return
+		}
+		dropBooking(record, notifyDeclined, "")
+		return
+	}
+
+	dtstart := event.Props.Get(ical.PropDateTimeStart)
+	if dtstart == nil {
+		return
+	}
+	start, err := dtstart.DateTime(time.UTC)
+	if err != nil {
+		return
+	}
+	start = start.UTC()
+	minutes := int(eventDuration(event, start).Minutes())
+
+	date, slotTime := start.Format("2006-01-02"), start.Format("15:04")
+	if date == record.Date && slotTime == record.Time && minutes == record.Duration {
+		return
+	}
+
+	log.Printf("Booking %s was moved in the calendar to %s %s", record.Code, date, slotTime)
+	moved := record
+	moved.Date, moved.Time, moved.Duration = date, slotTime, minutes
+	moved.Sequence++
+	moved.RemindersSent = nil
+	// Tell the booker only about the move that was actually stored
+	if replaceBooking(&moved) {
+		notify(Notification{Event: notifyMoved, Booking: moved})
+		notify(Notification{Event: notifyMoved, Owner: true, Booking: moved})
+	}
+}
+
+// dropBooking forgets a booking the owner took back and tells the booker
+// and the owner.
+// A booking changed since it was copied, such as a seat that moved to
+// another session, is left alone.
+func dropBooking(record Booking, event, reason string) {
+	if removeUnchangedBooking(record) {
+		log.Printf("Booking %s is gone from the calendar (%s)", record.Code, event)
+		notify(Notification{Event: event, Booking: record, Reason: reason})
+		notify(Notification{Event: event, Owner: true, Booking: record, Reason: reason})
+	}
+}
+
+// bookingAttendee finds the ATTENDEE added for a booking
+func bookingAttendee(event *ical.Component, code string) (ical.Prop, bool) {
+	for _, attendee := range event.Props.Values(ical.PropAttendee) {
+		if attendee.Params.Get(paramBookingCode) == code {
+			return attendee, true
+		}
+	}
+	return ical.Prop{}, false
+}
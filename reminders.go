@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+var (
+	ReminderOffsets = parseReminderOffsets(getEnvStr("REMINDER_OFFSETS", "24h,1h")) // How long before a meeting reminders go out
+	ReminderOwner   = getEnvStr("REMINDER_OWNER", "false") == "true"                // Remind the owner too
+)
+
+// parseReminderOffsets reads a comma-separated list of durations such as
+// "24h,1h,15m". An empty list turns reminders off.
+func parseReminderOffsets(value string) []time.Duration {
+	var offsets []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		offset, err := time.ParseDuration(part)
+		if err != nil || offset <= 0 {
+			log.Fatalf("Invalid REMINDER_OFFSETS entry %q", part)
+		}
+		offsets = append(offsets, offset)
+	}
+	return offsets
+}
+
+// initReminders starts the reminder scheduler. Pending reminders are
+// worked out from the stored bookings on every tick, so nothing is lost
+// across restarts when BOOKINGS_FILE is set.
+func initReminders() {
+	if len(ReminderOffsets) == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			sendDueReminders(time.Now())
+			<-ticker.C
+		}
+	}()
+}
+
+// sendDueReminders sends the reminders that are due. When several are due
+// at once, after downtime, only the one closest to the meeting goes out.
+func sendDueReminders(now time.Time) {
+	for _, record := range listBookings() {
+		start, err := time.Parse("2006-01-02 15:04", record.Date+" "+record.Time)
+		if err != nil || !now.Before(start) {
+			continue
+		}
+
+		var due []time.Duration
+		for _, offset := range ReminderOffsets {
+			if !now.Before(start.Add(-offset)) && !slices.Contains(record.RemindersSent, offset.String()) {
+				due = append(due, offset)
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+
+		updated := record
+		updated.RemindersSent = slices.Clone(record.RemindersSent)
+		for _, offset := range due {
+			updated.RemindersSent = append(updated.RemindersSent, offset.String())
+		}
+		// Changed meanwhile, the next tick looks at it again
+		if !replaceBooking(&updated) {
+			continue
+		}
+
+		// No reminder for offsets that had passed when the booking was made
+		closest := slices.Min(due)
+		if start.Add(-closest).Before(record.CreatedAt) {
+			continue
+		}
+
+		log.Printf("Sending %s reminder for booking %s", closest, record.Code)
+		notify(Notification{Event: notifyReminder, Booking: updated})
+		if ReminderOwner {
+			notify(Notification{Event: notifyReminder, Owner: true, Booking: updated})
+		}
+	}
+}
+
+// addAlarms adds a display alarm to the event for every reminder offset
+func addAlarms(event *ical.Component, summary string) {
+	for _, offset := range ReminderOffsets {
+		alarm := ical.NewComponent(ical.CompAlarm)
+		alarm.Props.SetText(ical.PropAction, "DISPLAY")
+		alarm.Props.SetText(ical.PropDescription, summary)
+
+		trigger := ical.NewProp(ical.PropTrigger)
+		trigger.SetValueType(ical.ValueDuration)
+		trigger.Value = alarmTrigger(offset)
+		alarm.Props.Set(trigger)
+
+		event.Children = append(event.Children, alarm)
+	}
+}
+
+// removeAlarms drops the alarms of an event that no longer takes place
+func removeAlarms(event *ical.Component) {
+	event.Children = slices.DeleteFunc(event.Children, func(child *ical.Component) bool {
+		return child.Name == ical.CompAlarm
+	})
+}
+
+// alarmTrigger formats an offset before the start as an iCalendar duration
+func alarmTrigger(offset time.Duration) string {
+	minutes := int(offset.Minutes())
+	if minutes%60 == 0 {
+		return fmt.Sprintf("-PT%dH", minutes/60)
+	}
+	return fmt.Sprintf("-PT%dM", minutes)
+}
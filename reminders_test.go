@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recordingNotifier passes notifications on to a channel
+type recordingNotifier chan Notification
+
+func (r recordingNotifier) Notify(ctx context.Context, n Notification) error {
+	r <- n
+	return nil
+}
+
+// useTestNotifier replaces the notifiers and the stored bookings for the
+// duration of a test
+func useTestNotifier(t *testing.T) recordingNotifier {
+	t.Helper()
+
+	recorder := make(recordingNotifier, 10)
+	savedNotifiers, savedBookings := notifiers, bookings
+	notifiers, bookings = []Notifier{recorder}, make(map[string]*Booking)
+	t.Cleanup(func() { notifiers, bookings = savedNotifiers, savedBookings })
+	return recorder
+}
+
+// sentReminders collects the reminders sent within a short wait
+func sentReminders(recorder recordingNotifier) []Notification {
+	var sent []Notification
+	for {
+		select {
+		case n := <-recorder:
+			sent = append(sent, n)
+		case <-time.After(100 * time.Millisecond):
+			return sent
+		}
+	}
+}
+
+func TestSendDueReminders(t *testing.T) {
+	offsets, owner := ReminderOffsets, ReminderOwner
+	ReminderOffsets, ReminderOwner = []time.Duration{24 * time.Hour, time.Hour}, false
+	t.Cleanup(func() { ReminderOffsets, ReminderOwner = offsets, owner })
+
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	longAgo := now.Add(-7 * 24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		start     time.Time
+		createdAt time.Time
+		sent      []string // Reminders already handled
+		want      time.Duration
+		wantSent  []string
+	}{
+		{
+			name:      "first offset due",
+			start:     now.Add(20 * time.Hour),
+			createdAt: longAgo,
+			want:      24 * time.Hour,
+			wantSent:  []string{"24h0m0s"},
+		},
+		{
+			name:      "later offset due",
+			start:     now.Add(30 * time.Minute),
+			createdAt: longAgo,
+			sent:      []string{"24h0m0s"},
+			want:      time.Hour,
+			wantSent:  []string{"24h0m0s", "1h0m0s"},
+		},
+		{
+			name:      "several due after downtime, only the closest goes out",
+			start:     now.Add(30 * time.Minute),
+			createdAt: longAgo,
+			want:      time.Hour,
+			wantSent:  []string{"24h0m0s", "1h0m0s"},
+		},
+		{
+			name:      "offsets passed when booked are skipped",
+			start:     now.Add(30 * time.Minute),
+			createdAt: now.Add(-10 * time.Minute),
+			wantSent:  []string{"24h0m0s", "1h0m0s"},
+		},
+		{
+			name:      "closest offset still ahead at booking",
+			start:     now.Add(30 * time.Minute),
+			createdAt: now.Add(-2 * time.Hour),
+			want:      time.Hour,
+			wantSent:  []string{"24h0m0s", "1h0m0s"},
+		},
+		{
+			name:      "nothing due yet",
+			start:     now.Add(30 * time.Hour),
+			createdAt: longAgo,
+		},
+		{
+			name:      "all sent",
+			start:     now.Add(30 * time.Minute),
+			createdAt: longAgo,
+			sent:      []string{"24h0m0s", "1h0m0s"},
+			wantSent:  []string{"24h0m0s", "1h0m0s"},
+		},
+		{
+			name:      "meeting already started",
+			start:     now.Add(-time.Minute),
+			createdAt: longAgo,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := useTestNotifier(t)
+			saveBooking(&Booking{
+				Code:          "7KQ2-MX9D-4HZT-P0WB",
+				Date:          test.start.Format("2006-01-02"),
+				Time:          test.start.Format("15:04"),
+				Duration:      60,
+				CreatedAt:     test.createdAt,
+				RemindersSent: test.sent,
+			})
+
+			sendDueReminders(now)
+
+			sent := sentReminders(recorder)
+			switch {
+			case test.want == 0 && len(sent) > 0:
+				t.Errorf("sent %d reminders, want none", len(sent))
+			case test.want != 0 && len(sent) != 1:
+				t.Errorf("sent %d reminders, want one", len(sent))
+			case test.want != 0 && sent[0].Event != notifyReminder:
+				t.Errorf("sent %s, want a reminder", sent[0].Event)
+			}
+
+			stored, _ := getBooking("7KQ2-MX9D-4HZT-P0WB")
+			if !slices.Equal(stored.RemindersSent, test.wantSent) {
+				t.Errorf("reminders sent = %v, want %v", stored.RemindersSent, test.wantSent)
+			}
+
+			// The next tick at the same time sends nothing again
+			sendDueReminders(now)
+			if again := sentReminders(recorder); len(again) > 0 {
+				t.Errorf("sent %d reminders again", len(again))
+			}
+		})
+	}
+}
+
+func TestSendDueRemindersSkipsChangedBooking(t *testing.T) {
+	offsets := ReminderOffsets
+	ReminderOffsets = []time.Duration{time.Hour}
+	t.Cleanup(func() { ReminderOffsets = offsets })
+
+	recorder := useTestNotifier(t)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	start := now.Add(30 * time.Minute)
+	record := &Booking{
+		Code:      "7KQ2-MX9D-4HZT-P0WB",
+		Date:      start.Format("2006-01-02"),
+		Time:      start.Format("15:04"),
+		CreatedAt: now.Add(-48 * time.Hour),
+	}
+	saveBooking(record)
+
+	// A copy taken before a move must not overwrite it
+	stale := *record
+	moved := *record
+	moved.Time = start.Add(2 * time.Hour).Format("15:04")
+	saveBooking(&moved)
+
+	stale.RemindersSent = []string{"1h0m0s"}
+	if replaceBooking(&stale) {
+		t.Fatal("replaceBooking stored a copy of an older revision")
+	}
+	if stored, _ := getBooking(record.Code); stored.Time != moved.Time {
+		t.Errorf("time = %s, want the moved %s", stored.Time, moved.Time)
+	}
+
+	sendDueReminders(now)
+	if sent := sentReminders(recorder); len(sent) > 0 {
+		t.Errorf("sent %d reminders for a meeting moved out of the window", len(sent))
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// paramBookingCode marks which booking an ATTENDEE of a group session
+// belongs to, so cancelling a seat removes only that attendee
+const paramBookingCode = "X-BOOKMYMEET-CODE"
+
+// errSessionFull is returned when every seat of a group session is taken
+var errSessionFull = errors.New("no seats left")
+
+// seatsMutex serializes changes to group sessions so that two bookings
+// cannot take the last seat at once
+var seatsMutex sync.Mutex
+
+// maxSessionUIDs limits the UIDs tried for one slot in findSession
+const maxSessionUIDs = 10
+
+// groupUID returns the event UID of the group session of a meeting type
+// starting at the given time. A session the owner moved away keeps its
+// UID, so a new session at the old time takes the next one: n counts from 1.
+func groupUID(typeID string, start time.Time, n int) string {
+	if n > 1 {
+		return fmt.Sprintf("group-%s-%s-%d@BookMyMeet", typeID, start.UTC().Format("20060102T1504"), n)
+	}
+	return fmt.Sprintf("group-%s-%s@BookMyMeet", typeID, start.UTC().Format("20060102T1504"))
+}
+
+// isGroupUID reports whether uid is one of the UIDs findSession tries for
+// a group session at start
+func isGroupUID(uid, typeID string, start time.Time) bool {
+	for n := 1; n <= maxSessionUIDs; n++ {
+		if uid == groupUID(typeID, start, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// findSession looks up the group session of a meeting type at start. It
+// returns the session's UID and calendar object, or a free UID and a nil
+// calendar when there is no session yet. Sessions found under the UID but
+// moved to another time by the owner are skipped.
+func findSession(ctx context.Context, typeID string, start time.Time) (string, *ical.Calendar, error) {
+	for n := 1; n <= maxSessionUIDs; n++ {
+		uid := groupUID(typeID, start, n)
+		cal, err := backend.FindByUID(ctx, uid)
+		if errors.Is(err, ErrEventNotFound) {
+			return uid, nil, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+
+		event := calendarEvent(cal)
+		if event == nil {
+			return "", nil, fmt.Errorf("group session %s has no event", uid)
+		}
+		if eventStart, err := event.Props.DateTime(ical.PropDateTimeStart, time.UTC); err == nil && eventStart.Equal(start) {
+			return uid, cal, nil
+		}
+	}
+	return "", nil, fmt.Errorf("no free UID for a group session at %s", start.UTC().Format(time.RFC3339))
+}
+
+// bookSeat adds the booker as an attendee of the group session. The first
+// seat creates the event with the location of the record; later seats
+// take the location of the event, so everybody joins the same room.
+func bookSeat(meetingType MeetingType, start time.Time, duration time.Duration, record *Booking) (string, error) {
+	ctx := context.Background()
+
+	seatsMutex.Lock()
+	defer seatsMutex.Unlock()
+
+	uid, cal, err := findSession(ctx, meetingType.ID, start)
+	if err != nil {
+		return "", err
+	}
+	if cal == nil {
+		summary, _, err := eventTexts(*record)
+		if err != nil {
+			return "", err
+		}
+		cal, event := newEventCalendar(uid, start, duration, summary)
+		setEventLocation(event, record.Location, record.VideoURL)
+		if err := addAttendee(event, record); err != nil {
+			return "", err
+		}
+
+		log.Printf("Creating group session %s", uid)
+		return uid, backend.CreateEvent(ctx, cal)
+	}
+
+	event := calendarEvent(cal)
+	if len(event.Props.Values(ical.PropAttendee)) >= meetingType.Seats {
+		return "", errSessionFull
+	}
+	if location, videoURL := eventLocation(event); location != "" {
+		record.Location, record.VideoURL = location, videoURL
+	}
+	if err := addAttendee(event, record); err != nil {
+		return "", err
+	}
+
+	log.Printf("Adding seat %s to group session %s", record.Code, uid)
+	return uid, backend.UpdateEvent(ctx, cal)
+}
+
+// cancelSeat removes the attendee of a booking from its group session and
+// deletes the session when nobody is left
+func cancelSeat(b *Booking) error {
+	ctx := context.Background()
+
+	seatsMutex.Lock()
+	defer seatsMutex.Unlock()
+
+	cal, err := backend.FindByUID(ctx, b.UID)
+	if errors.Is(err, ErrEventNotFound) {
+		log.Printf("Group session already missing: %s", b.UID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	event := calendarEvent(cal)
+	if event == nil {
+		return fmt.Errorf("group session %s has no event", b.UID)
+	}
+	removeAttendee(event, b.Code)
+
+	if len(event.Props.Values(ical.PropAttendee)) == 0 {
+		log.Printf("Deleting empty group session %s", b.UID)
+		err := backend.DeleteEvent(ctx, b.UID)
+		if errors.Is(err, ErrEventNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	log.Printf("Removing seat %s from group session %s", b.Code, b.UID)
+	return backend.UpdateEvent(ctx, cal)
+}
+
+// updateSeat replaces the attendee of a booking with its current details
+func updateSeat(b *Booking) error {
+	ctx := context.Background()
+
+	seatsMutex.Lock()
+	defer seatsMutex.Unlock()
+
+	cal, err := backend.FindByUID(ctx, b.UID)
+	if err != nil {
+		return err
+	}
+	event := calendarEvent(cal)
+	if event == nil {
+		return fmt.Errorf("group session %s has no event", b.UID)
+	}
+
+	removeAttendee(event, b.Code)
+	if err := addAttendee(event, b); err != nil {
+		return err
+	}
+	return backend.UpdateEvent(ctx, cal)
+}
+
+// addAttendee adds the booker as an ATTENDEE, their answers and the line
+// rendered from seat.txt to the description
+func addAttendee(event *ical.Component, b *Booking) error {
+	_, line, err := eventTexts(*b)
+	if err != nil {
+		return err
+	}
+
+	attendee := ical.NewProp(ical.PropAttendee)
+	attendee.Value = attendeeAddress(b)
+	attendee.Params.Set(ical.ParamCommonName, paramValue(b.FullName))
+	attendee.Params.Set(ical.ParamParticipationStatus, "ACCEPTED")
+	attendee.Params.Set(paramBookingCode, b.Code)
+	event.Props.Add(attendee)
+	setAnswerProps(event, b)
+	setContactProps(event, b)
+
+	if description, _ := event.Props.Text(ical.PropDescription); description != "" {
+		line = description + "\n" + line
+	}
+	event.Props.SetText(ical.PropDescription, line)
+	return nil
+}
+
+// removeAttendee drops the ATTENDEE, answers, contacts and description
+// line of a booking. The line is the one holding the booking code.
+func removeAttendee(event *ical.Component, code string) {
+	removeBookingProps(event, propAnswer, code)
+	removeBookingProps(event, propContact, code)
+
+	var attendees []ical.Prop
+	for _, attendee := range event.Props.Values(ical.PropAttendee) {
+		if attendee.Params.Get(paramBookingCode) != code {
+			attendees = append(attendees, attendee)
+		}
+	}
+	if len(attendees) > 0 {
+		event.Props[ical.PropAttendee] = attendees
+	} else {
+		event.Props.Del(ical.PropAttendee)
+	}
+
+	description, _ := event.Props.Text(ical.PropDescription)
+	var lines []string
+	for _, line := range strings.Split(description, "\n") {
+		if !strings.Contains(line, code) {
+			lines = append(lines, line)
+		}
+	}
+	event.Props.SetText(ical.PropDescription, strings.Join(lines, "\n"))
+}
+
+// attendeeAddress returns a mailto: address when the booker left an email
+// address, a tel: one for a phone number, or an address derived from the
+// booking code otherwise
+func attendeeAddress(b *Booking) string {
+	if email := b.contact(channelEmail); email != "" {
+		return "mailto:" + email
+	}
+	if phone := b.contact(channelPhone); phone != "" {
+		return "tel:" + phone
+	}
+	return "urn:bookmymeet:" + b.Code
+}
+
+// paramValue makes text safe for a parameter value, which cannot hold
+// double quotes
+func paramValue(text string) string {
+	return strings.ReplaceAll(text, `"`, "'")
+}
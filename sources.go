@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// CalendarSource describes an extra busy-time calendar that may live on a
+// different CalDAV server with its own credentials
+type CalendarSource struct {
+	Name      string
+	URL       string
+	Auth      AuthConfig
+	Calendars []string // Paths relative to URL, empty means URL itself
+}
+
+var calendarSources []CalendarSource
+
+// loadCalendarSources reads CALDAV_SOURCE_<N>_* variables starting at N=1
+// until the first missing URL
+func loadCalendarSources() []CalendarSource {
+	var sources []CalendarSource
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("CALDAV_SOURCE_%d_", i)
+		url := getEnvStr(prefix+"URL", "")
+		if url == "" {
+			break
+		}
+
+		source := CalendarSource{
+			Name: getEnvStr(prefix+"NAME", fmt.Sprintf("source-%d", i)),
+			URL:  url,
+			Auth: loadAuthConfig(prefix, ""),
+		}
+
+		for _, cal := range getEnvStrSlice(prefix+"CALENDARS", "") {
+			if cal = strings.TrimSpace(cal); cal != "" {
+				source.Calendars = append(source.Calendars, cal)
+			}
+		}
+
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// initCalendarSources creates a CalDAV client for every configured source.
+// A broken source is logged and skipped so it cannot block bookings.
+func initCalendarSources() {
+	calendarSources = loadCalendarSources()
+
+	for _, source := range calendarSources {
+		httpClient, err := newAuthHTTPClient(source.Auth, 10*time.Second)
+		if err != nil {
+			log.Printf("Skipping calendar source %s: %v", source.Name, err)
+			continue
+		}
+
+		client, err := caldav.NewClient(httpClient, source.URL)
+		if err != nil {
+			log.Printf("Skipping calendar source %s: %v", source.Name, err)
+			continue
+		}
+
+		paths := source.Calendars
+		if len(paths) == 0 {
+			paths = []string{""}
+		}
+		busySources = append(busySources, newCalDAVBackend(client, paths))
+
+		log.Printf("Calendar source %s configured with %d calendar(s)", source.Name, len(paths))
+	}
+}
@@ -0,0 +1,214 @@
+document.addEventListener('DOMContentLoaded', function() {
+    const token = window.location.pathname.split('/').pop();
+    const apiBase = `/api/booking/${encodeURIComponent(token)}`;
+
+    const rescheduleDate = document.getElementById('rescheduleDate');
+    const rescheduleTime = document.getElementById('rescheduleTime');
+    const contactForm = document.getElementById('contactForm');
+    const modal = document.getElementById('modal');
+
+    let booking = null;
+    let availableSlots = {};
+    let csrfToken = '';
+
+    // Show a UTC date and time in the browser timezone
+    function formatLocal(date, time) {
+        return moment.utc(`${date} ${time}`, 'YYYY-MM-DD HH:mm').local().format('dddd, D MMMM YYYY, HH:mm');
+    }
+
+    async function getCSRFToken() {
+        try {
+            const response = await fetch('/api/csrf-token', {
+                credentials: 'include'
+            });
+            const data = await response.json();
+            csrfToken = data.token;
+        } catch (error) {
+            console.error('Error getting CSRF token:', error);
+        }
+    }
+
+    async function loadBooking() {
+        try {
+            const response = await fetch(apiBase);
+            if (!response.ok) {
+                document.getElementById('bookingMissing').style.display = 'block';
+                return;
+            }
+            booking = await response.json();
+        } catch (error) {
+            console.error('Error loading booking:', error);
+            document.getElementById('bookingMissing').style.display = 'block';
+            return;
+        }
+
+        document.getElementById('detailWhen').textContent =
+            `${formatLocal(booking.date, booking.time)} (${booking.duration} min)`;
+        document.getElementById('detailType').textContent = booking.meetingTypeName;
+        document.getElementById('detailTopic').textContent = booking.topic;
+        document.getElementById('detailCode').textContent = booking.code;
+        if (booking.location) {
+            const where = document.getElementById('detailLocation');
+            if (booking.videoUrl) {
+                const link = document.createElement('a');
+                link.href = booking.videoUrl;
+                link.textContent = booking.videoUrl;
+                link.target = '_blank';
+                link.rel = 'noopener';
+                where.appendChild(link);
+            } else {
+                where.textContent = booking.location;
+            }
+            document.getElementById('detailLocationLabel').style.display = '';
+            where.style.display = '';
+        }
+        if (booking.guests && booking.guests.length) {
+            document.getElementById('detailGuests').textContent = booking.guests.join(', ');
+            document.getElementById('detailGuestsLabel').style.display = '';
+            document.getElementById('detailGuests').style.display = '';
+        }
+        contactForm.elements.fullName.value = booking.fullName;
+        contactForm.elements.contactInfo.value = booking.contactInfo;
+
+        const download = document.getElementById('downloadIcs');
+        download.href = `${apiBase}/ics`;
+        download.style.display = 'inline-flex';
+
+        document.getElementById('bookingDetails').style.display = 'block';
+        document.getElementById('manageActions').style.display = 'block';
+        loadAvailableSlots();
+    }
+
+    async function loadAvailableSlots() {
+        try {
+            const params = new URLSearchParams({type: booking.meetingType, duration: booking.duration});
+            const response = await fetch('/api/v2/available?' + params.toString());
+            availableSlots = await response.json();
+        } catch (error) {
+            console.error('Error loading time slots:', error);
+            return;
+        }
+
+        rescheduleDate.innerHTML = '';
+        Object.keys(availableSlots).sort().forEach(date => {
+            const option = document.createElement('option');
+            option.value = date;
+            option.textContent = moment(date, 'YYYY-MM-DD').format('dddd, D MMMM');
+            rescheduleDate.appendChild(option);
+        });
+
+        document.getElementById('rescheduleSection').style.display =
+            rescheduleDate.options.length > 0 ? 'block' : 'none';
+        fillTimes();
+    }
+
+    function fillTimes() {
+        const date = rescheduleDate.value;
+        rescheduleTime.innerHTML = '';
+        (availableSlots[date] || []).forEach(slot => {
+            const option = document.createElement('option');
+            option.value = slot.time;
+            option.textContent = moment.utc(`${date} ${slot.time}`, 'YYYY-MM-DD HH:mm').local().format('HH:mm');
+            if (slot.seatsLeft) option.textContent += ` (${slot.seatsLeft} left)`;
+            rescheduleTime.appendChild(option);
+        });
+    }
+
+    rescheduleDate.addEventListener('change', fillTimes);
+
+    async function post(action, data) {
+        const response = await fetch(`${apiBase}/${action}`, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+                'X-CSRF-Token': csrfToken
+            },
+            credentials: 'include',
+            body: JSON.stringify({...data, _csrf: csrfToken})
+        });
+        return response.json();
+    }
+
+    document.getElementById('rescheduleForm').addEventListener('submit', async function(e) {
+        e.preventDefault();
+
+        try {
+            const result = await post('reschedule', {date: rescheduleDate.value, time: rescheduleTime.value});
+            if (result.success) {
+                showModal('Booking moved', `Your booking is now on ${formatLocal(rescheduleDate.value, rescheduleTime.value)}`);
+                loadBooking();
+            } else {
+                showModal('Error', result.error || 'Reschedule failed');
+            }
+        } catch (error) {
+            showModal('Error', 'Request failed');
+        }
+    });
+
+    contactForm.addEventListener('submit', async function(e) {
+        e.preventDefault();
+
+        const formData = new FormData(this);
+        try {
+            const result = await post('contact', {
+                fullName: formData.get('fullName'),
+                contactInfo: formData.get('contactInfo')
+            });
+            if (result.success) {
+                showModal('Details saved', 'Your contact details have been updated');
+            } else {
+                showModal('Error', result.error || 'Update failed');
+            }
+        } catch (error) {
+            showModal('Error', 'Request failed');
+        }
+    });
+
+    document.getElementById('cancelForm').addEventListener('submit', async function(e) {
+        e.preventDefault();
+
+        if (!confirm('Cancel this booking?')) {
+            return;
+        }
+
+        try {
+            const result = await post('cancel', {reason: this.elements.reason.value});
+            if (result.success) {
+                showModal('Booking canceled', 'Your booking has been canceled');
+                document.getElementById('bookingDetails').style.display = 'none';
+                document.getElementById('downloadIcs').style.display = 'none';
+                document.getElementById('rescheduleSection').style.display = 'none';
+                document.getElementById('manageActions').style.display = 'none';
+                document.getElementById('bookingMissing').style.display = 'block';
+            } else {
+                showModal('Error', result.error || 'Cancellation failed');
+            }
+        } catch (error) {
+            showModal('Error', 'Request failed');
+        }
+    });
+
+    function showModal(title, message) {
+        document.getElementById('modalTitle').textContent = title;
+        document.getElementById('modalMessage').textContent = message;
+        modal.style.display = 'block';
+    }
+
+    // Modal close handlers
+    document.getElementById('closeModal').addEventListener('click', function() {
+        modal.style.display = 'none';
+    });
+
+    document.getElementById('modalBtn').addEventListener('click', function() {
+        modal.style.display = 'none';
+    });
+
+    modal.addEventListener('click', function(e) {
+        if (e.target === modal) {
+            modal.style.display = 'none';
+        }
+    });
+
+    getCSRFToken();
+    loadBooking();
+});
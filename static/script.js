@@ -69,6 +69,8 @@ document.addEventListener('DOMContentLoaded', function() {
     const calendarBody = document.getElementById('calendarBody');
     const monthSelect = document.getElementById('monthSelect');
     const timezoneSelect = document.getElementById('timezoneSelect');
+    const meetingTypeSelect = document.getElementById('meetingTypeSelect');
+    const durationSelect = document.getElementById('durationSelect');
     const timeSlots = document.getElementById('timeSlots');
     const slotsGrid = document.getElementById('slotsGrid');
     const bookingForm = document.getElementById('bookingForm');
@@ -81,6 +83,7 @@ document.addEventListener('DOMContentLoaded', function() {
     let selectedDate = null;
     let selectedTime = null;
     let availableSlots = {};
+    let meetingTypes = [];
     
     // Convert time to specified timezone using moment-timezone
     function convertTimeToTimezone(time, timezone, baseDate = null) {
@@ -106,7 +109,7 @@ document.addEventListener('DOMContentLoaded', function() {
 
     // Initialization
     initializeSelectors();
-    loadAvailableSlots();
+    loadMeetingTypes();
     
     // Timezone change handler
     timezoneSelect.addEventListener('change', function() {
@@ -175,9 +178,207 @@ document.addEventListener('DOMContentLoaded', function() {
         });
     }
     
+    async function loadMeetingTypes() {
+        try {
+            const response = await fetch('/api/meeting-types');
+            meetingTypes = await response.json();
+        } catch (error) {
+            console.error('Error loading meeting types:', error);
+        }
+        
+        meetingTypeSelect.innerHTML = '';
+        meetingTypes.forEach(type => {
+            const option = document.createElement('option');
+            option.value = type.id;
+            option.textContent = type.name;
+            meetingTypeSelect.appendChild(option);
+        });
+        
+        initializeDurationSelector();
+        loadFormSchema();
+        loadAvailableSlots();
+    }
+    
+    // Extra questions of the selected meeting type and the contact channels
+    let questions = [];
+    let contactChannels = [];
+    
+    async function loadFormSchema() {
+        const container = document.getElementById('customQuestions');
+        container.innerHTML = '';
+        questions = [];
+        
+        let schema;
+        try {
+            const params = new URLSearchParams();
+            if (meetingTypeSelect.value) params.set('type', meetingTypeSelect.value);
+            const response = await fetch(`/api/form-schema?${params}`);
+            if (!response.ok) return;
+            schema = await response.json();
+            questions = schema.questions || [];
+        } catch (error) {
+            console.error('Error loading form schema:', error);
+            return;
+        }
+        
+        const disabled = !(selectedDate && selectedTime);
+        if (!contactChannels.length) {
+            contactChannels = schema.contacts || [];
+            renderContactFields(disabled);
+        }
+        questions.forEach(question => {
+            const group = document.createElement('div');
+            group.className = 'form-group';
+            
+            const label = document.createElement('label');
+            label.textContent = question.label + (question.required ? ' *' : '');
+            
+            let input;
+            if (question.type === 'textarea') {
+                input = document.createElement('textarea');
+                input.rows = 3;
+            } else if (question.type === 'select') {
+                input = document.createElement('select');
+                const empty = document.createElement('option');
+                empty.value = '';
+                empty.textContent = '—';
+                input.appendChild(empty);
+                question.options.forEach(value => {
+                    const option = document.createElement('option');
+                    option.value = value;
+                    option.textContent = value;
+                    input.appendChild(option);
+                });
+            } else {
+                input = document.createElement('input');
+                input.type = {checkbox: 'checkbox', email: 'email', phone: 'tel'}[question.type] || 'text';
+            }
+            if (question.maxLength) input.maxLength = question.maxLength;
+            if (question.help) input.placeholder = question.help;
+            input.name = 'q-' + question.id;
+            input.className = 'form-input';
+            input.disabled = disabled;
+            
+            if (question.type === 'checkbox') {
+                input.className = 'form-input form-checkbox';
+                label.prepend(input);
+                group.appendChild(label);
+            } else {
+                group.appendChild(label);
+                group.appendChild(input);
+            }
+            container.appendChild(group);
+        });
+    }
+    
+    // Contact channels are the same for every meeting type, so the fields
+    // are rendered once and keep what the booker typed
+    const contactPlaceholders = {
+        email: 'name@example.com',
+        phone: '+49 30 1234567',
+        telegram: '@username',
+        matrix: '@name:example.org',
+        other: 'Jami, URL or anything else'
+    };
+    
+    function renderContactFields(disabled) {
+        const container = document.getElementById('contactFields');
+        container.innerHTML = '';
+        
+        contactChannels.forEach(channel => {
+            const group = document.createElement('div');
+            group.className = 'form-group';
+            
+            const label = document.createElement('label');
+            label.textContent = channel.label + (channel.required ? ' *' : '');
+            
+            const input = document.createElement('input');
+            input.type = {email: 'email', phone: 'tel'}[channel.type] || 'text';
+            input.name = 'contact-' + channel.type;
+            input.placeholder = contactPlaceholders[channel.type] || '';
+            input.className = 'form-input';
+            input.disabled = disabled;
+            
+            group.appendChild(label);
+            group.appendChild(input);
+            container.appendChild(group);
+        });
+    }
+    
+    function collectContacts(formData) {
+        const contacts = {};
+        contactChannels.forEach(channel => {
+            const value = (formData.get('contact-' + channel.type) || '').trim();
+            if (value) contacts[channel.type] = value;
+        });
+        return contacts;
+    }
+    
+    function collectAnswers(formData) {
+        const answers = {};
+        questions.forEach(question => {
+            const name = 'q-' + question.id;
+            if (question.type === 'checkbox') {
+                answers[question.id] = formData.has(name);
+            } else if (formData.get(name)) {
+                answers[question.id] = formData.get(name);
+            }
+        });
+        return answers;
+    }
+    
+    // Fill durations of the selected meeting type
+    function initializeDurationSelector() {
+        const type = meetingTypes.find(t => t.id === meetingTypeSelect.value);
+        durationSelect.innerHTML = '';
+        
+        if (type) {
+            type.durations.forEach(minutes => {
+                const option = document.createElement('option');
+                option.value = minutes;
+                option.textContent = formatDuration(minutes);
+                if (minutes === type.defaultDuration) option.selected = true;
+                durationSelect.appendChild(option);
+            });
+        }
+        
+        // Phone meetings ask for the number to call
+        document.getElementById('phoneGroup').style.display =
+            type && type.location && type.location.mode === 'phone' ? '' : 'none';
+        
+        // Only show choices when there is something to choose
+        document.getElementById('meetingTypeGroup').style.display = meetingTypes.length > 1 ? '' : 'none';
+        document.getElementById('durationGroup').style.display = type && type.durations.length > 1 ? '' : 'none';
+        document.getElementById('meetingSelector').style.display =
+            meetingTypes.length > 1 || (type && type.durations.length > 1) ? '' : 'none';
+    }
+    
+    function formatDuration(minutes) {
+        const hours = Math.floor(minutes / 60);
+        const rest = minutes % 60;
+        if (hours === 0) return `${rest} min`;
+        return rest === 0 ? `${hours} h` : `${hours} h ${rest} min`;
+    }
+    
+    // Meeting type and duration change handlers
+    meetingTypeSelect.addEventListener('change', function() {
+        initializeDurationSelector();
+        loadFormSchema();
+        clearSelection();
+        loadAvailableSlots();
+    });
+    
+    durationSelect.addEventListener('change', function() {
+        clearSelection();
+        loadAvailableSlots();
+    });
+    
     async function loadAvailableSlots() {
         try {
-            const response = await fetch('/api/available');
+            const params = new URLSearchParams();
+            if (meetingTypeSelect.value) params.set('type', meetingTypeSelect.value);
+            if (durationSelect.value) params.set('duration', durationSelect.value);
+            const response = await fetch('/api/v2/available?' + params.toString());
             availableSlots = await response.json();
             const [month, year] = monthSelect.value.split(',').map(Number);
             generateCalendar(month, year);
@@ -281,16 +482,24 @@ document.addEventListener('DOMContentLoaded', function() {
         
         timeSlots.style.display = 'block';
         
-        slots.forEach(time => {
+        slots.forEach(slot => {
             const slotElement = document.createElement('div');
             slotElement.className = 'time-slot';
             
             // Convert time to selected timezone
-            const convertedTime = convertTimeToTimezone(time, currentTimezone, date);
+            const convertedTime = convertTimeToTimezone(slot.time, currentTimezone, date);
             slotElement.textContent = convertedTime;
             
+            // Group sessions show how many seats are left
+            if (slot.seatsLeft) {
+                const seats = document.createElement('span');
+                seats.className = 'seats-left';
+                seats.textContent = `${slot.seatsLeft} ${slot.seatsLeft === 1 ? 'seat' : 'seats'} left`;
+                slotElement.appendChild(seats);
+            }
+            
             slotElement.addEventListener('click', function() {
-                selectTimeSlot(time, slotElement); // Store original time for API
+                selectTimeSlot(slot.time, slotElement); // Store original time for API
             });
             
             slotsGrid.appendChild(slotElement);
@@ -372,7 +581,14 @@ document.addEventListener('DOMContentLoaded', function() {
             time: selectedTime,
             topic: escapeHtml(formData.get('topic')),
             fullName: escapeHtml(formData.get('fullName')),
-            contactInfo: escapeHtml(formData.get('contactInfo')),
+            contacts: collectContacts(formData),
+            meetingType: meetingTypeSelect.value,
+            duration: Number(durationSelect.value) || 0,
+            timezone: Intl.DateTimeFormat().resolvedOptions().timeZone || '',
+            language: navigator.language || '',
+            guests: (formData.get('guests') || '').split(/[,;\s]+/).filter(Boolean),
+            phone: formData.get('phone') || '',
+            answers: collectAnswers(formData),
             _csrf: csrfToken
         };
         
@@ -391,9 +607,9 @@ document.addEventListener('DOMContentLoaded', function() {
             
             if (result.success) {
                 const convertedTime = convertTimeToTimezone(selectedTime, currentTimezone, selectedDate);
-                showModal('Booking successful!', 
-                    `You are booked for ${selectedDate.toLocaleDateString('en-US')} at ${convertedTime}`, 
-                    result.code);
+                let message = `You are booked for ${selectedDate.toLocaleDateString('en-US')} at ${convertedTime}`;
+                if (result.location) message += `\nWhere: ${result.location}`;
+                showModal('Booking successful!', message, result.code, result.manageUrl);
                 
                 // Clear form and selection
                 this.reset();
@@ -411,9 +627,14 @@ document.addEventListener('DOMContentLoaded', function() {
     const cancelCodeInput = document.getElementById('cancelCode');
     const cancelBtn = document.querySelector('.cancel-btn');
     
-    // Code length validation and button disabling
+    // Codes are 16 characters, dashes and spaces are optional
+    function isValidCode(value) {
+        return /^[0-9A-Za-z]{16}$/.test(value.replace(/[-\s]/g, ''));
+    }
+
+    // Code validation and button disabling
     cancelCodeInput.addEventListener('input', function() {
-        if (this.value.length != 8){
+        if (!isValidCode(this.value)){
             cancelBtn.disabled = true
         }
         else {
@@ -447,7 +668,7 @@ document.addEventListener('DOMContentLoaded', function() {
     const savedCode = getLocalStorage('cancelCode');
     if (savedCode) {
         cancelCodeInput.value = savedCode;
-        cancelBtn.disabled = savedCode.length != 8;
+        cancelBtn.disabled = !isValidCode(savedCode);
     }
 
 
@@ -466,6 +687,7 @@ document.addEventListener('DOMContentLoaded', function() {
         const code = escapeHtml(formData.get('code'));
         const cancelData = { 
             code,
+            reason: formData.get('reason') || '',
             _csrf: csrfToken
         };
         
@@ -506,7 +728,7 @@ document.addEventListener('DOMContentLoaded', function() {
         updateBookingButton();
     }
     
-    function showModal(title, message, code = null) {
+    function showModal(title, message, code = null, manageUrl = null) {
         document.getElementById('modalTitle').textContent = title;
         document.getElementById('modalMessage').textContent = message;
         
@@ -522,6 +744,14 @@ document.addEventListener('DOMContentLoaded', function() {
             modalCode.style.display = 'none';
         }
         
+        const manageLinkGroup = document.getElementById('manageLinkGroup');
+        if (manageUrl) {
+            document.getElementById('manageLink').href = manageUrl;
+            manageLinkGroup.style.display = 'block';
+        } else {
+            manageLinkGroup.style.display = 'none';
+        }
+        
         modal.style.display = 'block';
     }
     
@@ -0,0 +1,296 @@
+package main
+
+import (
+	htmltemplate "html/template"
+	"io"
+	"io/fs"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	TemplatesDir  = getEnvStr("TEMPLATES_DIR", "")  // Directory with templates overriding the built-in texts
+	OwnerLanguage = getEnvStr("OWNER_LANGUAGE", "") // Language of event texts and the owner's emails
+)
+
+// executor is a parsed text or HTML template
+type executor interface {
+	Execute(w io.Writer, data any) error
+}
+
+// Built-in texts, used when TEMPLATES_DIR has no matching template
+var builtinTemplates = map[string]string{
+	"summary.txt": `{{.Booking.Topic}}`,
+	"description.txt": `Who are you?: {{.Booking.FullName}}
+Contact method: {{.Booking.ContactInfo}}
+Meeting type: {{.MeetingType}} ({{.Booking.Duration}} min)
+{{- if .Booking.Guests}}
+Guests: {{range $i, $guest := .Booking.Guests}}{{if $i}}, {{end}}{{$guest}}{{end}}
+{{- end}}
+{{- range .Booking.Answers}}
+{{.Label}}: {{.Value}}
+{{- end}}
+Cancellation code: {{.Booking.Code}}`,
+	"session-summary.txt": `{{.MeetingType}}`,
+	"seat.txt": `{{.Booking.FullName}} | {{.Booking.ContactInfo}} | {{.Booking.Topic}}
+{{- range .Booking.Answers}} | {{.Label}}: {{.Value}}{{end}} | Cancellation code: {{.Booking.Code}}`,
+	"subject.txt": `{{.Title}}: {{.Booking.Topic}}`,
+	"email.txt": `{{if .Guest -}}
+Hello,
+
+{{.Booking.FullName}} added you as a guest. {{.Intro}}
+{{- else -}}
+Hello {{.Booking.FullName}},
+
+{{.Intro}}
+{{- end}}
+
+When: {{.When}}
+Meeting type: {{.MeetingType}} ({{.Booking.Duration}} min)
+Topic: {{.Booking.Topic}}
+{{- if .Booking.Location}}
+Where: {{.Booking.Location}}
+{{- end}}
+{{- if .Reason}}
+Reason: {{.Reason}}
+{{- end}}
+{{- if and .Active (not .Guest)}}
+
+Cancellation code: {{.Booking.Code}}
+{{- if .ManageURL}}
+Manage your booking: {{.ManageURL}}
+{{- end}}
+{{- end}}
+`,
+	"owner-subject.txt": `{{.Title}}: {{.Booking.Topic}}`,
+	"push.txt": `{{.When}}
+{{.Booking.FullName}} ({{.Booking.ContactInfo}})
+{{- if .Reason}}
+Reason: {{.Reason}}
+{{- end}}`,
+	"owner.txt": `{{.Intro}}
+
+When: {{.When}}
+Meeting type: {{.MeetingType}} ({{.Booking.Duration}} min)
+Topic: {{.Booking.Topic}}
+{{- if .Booking.Location}}
+Where: {{.Booking.Location}}
+{{- end}}
+Who: {{.Booking.FullName}}
+Contact method: {{.Booking.ContactInfo}}
+{{- if .Booking.Guests}}
+Guests: {{range $i, $guest := .Booking.Guests}}{{if $i}}, {{end}}{{$guest}}{{end}}
+{{- end}}
+{{- range .Booking.Answers}}
+{{.Label}}: {{.Value}}
+{{- end}}
+{{- if .Reason}}
+Reason: {{.Reason}}
+{{- end}}
+`,
+}
+
+// templates holds the parsed files of TEMPLATES_DIR by relative path
+var templates = make(map[string]executor)
+
+// MessageData is what templates can use
+type MessageData struct {
+	Booking     Booking
+	Event       string // confirmed, rescheduled, moved, cancelled, ...
+	Title       string // Default subject line
+	Intro       string // Default opening sentence
+	Reason      string
+	MeetingType string    // Display name of the meeting type
+	Start       time.Time // In the reader's timezone
+	End         time.Time
+	Timezone    string
+	When        string // Start and end, formatted
+	ManageURL   string // Absolute management link, empty without BASE_URL
+	Active      bool   // The booking still stands, it was not cancelled
+	Guest       string // Address of the guest an email is for, empty for the booker
+}
+
+// initTemplates parses every .txt and .html file below TEMPLATES_DIR so
+// that mistakes show up at start
+func initTemplates() {
+	for name, text := range builtinTemplates {
+		template.Must(template.New(name).Parse(text))
+	}
+	if TemplatesDir == "" {
+		return
+	}
+
+	err := filepath.WalkDir(TemplatesDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(TemplatesDir, path)
+		if err != nil {
+			return err
+		}
+
+		var t executor
+		switch filepath.Ext(path) {
+		case ".txt":
+			t, err = template.ParseFiles(path)
+		case ".html":
+			t, err = htmltemplate.ParseFiles(path)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		templates[filepath.ToSlash(rel)] = t
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("Error loading templates: %v", err)
+	}
+	for name, t := range templates {
+		if path.Base(name) == "seat.txt" {
+			checkSeatTemplate(name, t)
+		}
+	}
+	log.Printf("Loaded %d templates from %s", len(templates), TemplatesDir)
+}
+
+// checkSeatTemplate makes sure a seat.txt template writes the booking
+// code, which identifies the line of a seat in the session description
+func checkSeatTemplate(name string, t executor) {
+	data := MessageData{Booking: Booking{Code: "SAMPLE-CODE", FullName: "Sample", Duration: 30}}
+
+	var text strings.Builder
+	if err := t.Execute(&text, data); err != nil {
+		log.Fatalf("Error in template %s: %v", name, err)
+	}
+	if !strings.Contains(text.String(), data.Booking.Code) {
+		log.Fatalf("Template %s must include {{.Booking.Code}}", name)
+	}
+}
+
+// findTemplate picks the first of names in the most specific directory:
+// <meeting type>/<language>, <meeting type>, <language>, then the top of
+// TEMPLATES_DIR. Languages are tried in full (pt-br) and as their primary
+// subtag (pt).
+func findTemplate(names []string, meetingType, language string) (executor, bool) {
+	var languages []string
+	if language != "" {
+		languages = append(languages, language)
+		if primary, _, found := strings.Cut(language, "-"); found {
+			languages = append(languages, primary)
+		}
+	}
+
+	var dirs []string
+	for _, lang := range languages {
+		dirs = append(dirs, meetingType+"/"+lang)
+	}
+	dirs = append(dirs, meetingType)
+	dirs = append(dirs, languages...)
+	dirs = append(dirs, "")
+
+	for _, dir := range dirs {
+		for _, name := range names {
+			if t, ok := templates[strings.TrimPrefix(dir+"/"+name, "/")]; ok {
+				return t, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// renderText executes the first matching template of names, falling back
+// to the built-in text of the last name
+func renderText(names []string, language string, data MessageData) (string, error) {
+	t, ok := findTemplate(names, data.Booking.MeetingType, language)
+	if !ok {
+		t = template.Must(template.New("").Parse(builtinTemplates[names[len(names)-1]]))
+	}
+
+	var text strings.Builder
+	if err := t.Execute(&text, data); err != nil {
+		return "", err
+	}
+	return text.String(), nil
+}
+
+// renderHTML executes the first matching HTML template of names. There
+// are no built-in HTML templates, so it returns an empty string unless
+// TEMPLATES_DIR provides one.
+func renderHTML(names []string, language string, data MessageData) (string, error) {
+	t, ok := findTemplate(names, data.Booking.MeetingType, language)
+	if !ok {
+		return "", nil
+	}
+
+	var text strings.Builder
+	if err := t.Execute(&text, data); err != nil {
+		return "", err
+	}
+	return text.String(), nil
+}
+
+// messageData prepares the template data for a booking, with times in loc
+func messageData(b Booking, event string, loc *time.Location) MessageData {
+	data := MessageData{
+		Booking:     b,
+		Event:       event,
+		MeetingType: meetingTypeName(b.MeetingType),
+		Timezone:    loc.String(),
+		When:        formatMeetingTime(b, loc),
+		Active:      event != notifyCancelled && event != notifyOwnerCancelled && event != notifyDeclined,
+	}
+	if start, err := time.Parse("2006-01-02 15:04", b.Date+" "+b.Time); err == nil {
+		data.Start = start.In(loc)
+		data.End = data.Start.Add(time.Duration(b.Duration) * time.Minute)
+	}
+	if BaseURL != "" {
+		data.ManageURL = manageURL(b.Code)
+	}
+	return data
+}
+
+// eventTexts renders the summary and description of a booking's event.
+// For a seat these are the summary of its group session and the line of
+// the seat in the session description, written on a single line.
+func eventTexts(b Booking) (string, string, error) {
+	data := messageData(b, notifyConfirmed, time.UTC)
+
+	summaryName, descriptionName := "summary.txt", "description.txt"
+	if b.Seat {
+		summaryName, descriptionName = "session-summary.txt", "seat.txt"
+	}
+
+	summary, err := renderText([]string{summaryName}, OwnerLanguage, data)
+	if err != nil {
+		return "", "", err
+	}
+	description, err := renderText([]string{descriptionName}, OwnerLanguage, data)
+	if err != nil {
+		return "", "", err
+	}
+	if b.Seat {
+		description = strings.Join(strings.Fields(description), " ")
+	}
+	return strings.TrimSpace(summary), strings.TrimSpace(description), nil
+}
+
+// normalizeLanguage turns a browser language tag into a safe directory
+// name such as "de" or "pt-br", or an empty string
+func normalizeLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || len(tag) > 12 {
+		return ""
+	}
+	for _, r := range tag {
+		if (r < 'a' || r > 'z') && r != '-' {
+			return ""
+		}
+	}
+	return tag
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-ical"
+	"github.com/emersion/go-webdav/caldav"
+)
+
+// Component names from RFC 7953
+const (
+	compAvailability = "VAVAILABILITY"
+	compAvailable    = "AVAILABLE"
+)
+
+// AvailabilityResource locates the VAVAILABILITY components: an .ics object
+// or calendar path on the CalDAV server, a file:// or http(s):// ICS, or
+// empty to search every calendar in the calendar home
+var AvailabilityResource = getEnvStr("AVAILABILITY_RESOURCE", "")
+
+// vavailabilitySource builds windows from VAVAILABILITY components. The
+// components are reloaded after the refresh interval.
+type vavailabilitySource struct {
+	load    func(ctx context.Context) ([]*ical.Component, error)
+	refresh time.Duration
+
+	mu         sync.Mutex
+	components []*ical.Component
+	loadedAt   time.Time
+}
+
+func newVAvailabilitySource() *vavailabilitySource {
+	source := &vavailabilitySource{
+		refresh: time.Duration(getEnvInt("AVAILABILITY_REFRESH", 15)) * time.Minute,
+	}
+
+	switch {
+	case strings.Contains(AvailabilityResource, "://") || (caldavClient == nil && AvailabilityResource != ""):
+		// ICS file or URL
+		client, err := newAuthHTTPClient(loadAuthConfig("AVAILABILITY_", ""), 30*time.Second)
+		if err != nil {
+			log.Fatalf("Error configuring availability resource: %v", err)
+		}
+		source.load = func(ctx context.Context) ([]*ical.Component, error) {
+			body, err := openICS(ctx, client, AvailabilityResource)
+			if err != nil {
+				return nil, err
+			}
+			defer body.Close()
+			return parseICSComponents(body, compAvailability)
+		}
+	case caldavClient != nil:
+		source.load = caldavAvailabilityLoader(AvailabilityResource)
+	default:
+		log.Fatalf("AVAILABILITY_RESOURCE must be an ICS file or URL unless CALENDAR_BACKEND=caldav")
+	}
+
+	return source
+}
+
+// caldavAvailabilityLoader reads VAVAILABILITY components from a calendar
+// object, a calendar, or all calendars in the home set
+func caldavAvailabilityLoader(resource string) func(ctx context.Context) ([]*ical.Component, error) {
+	return func(ctx context.Context) ([]*ical.Component, error) {
+		if strings.HasSuffix(strings.ToLower(resource), ".ics") {
+			obj, err := caldavClient.GetCalendarObject(ctx, resource)
+			if err != nil {
+				return nil, err
+			}
+			return componentsByName(obj.Data, compAvailability), nil
+		}
+
+		calendars := []string{resource}
+		if resource == "" {
+			found, err := caldavClient.FindCalendars(ctx, "")
+			if err != nil {
+				return nil, err
+			}
+			calendars = calendars[:0]
+			for _, cal := range found {
+				calendars = append(calendars, cal.Path)
+			}
+		}
+
+		query := &caldav.CalendarQuery{
+			CompRequest: caldav.CalendarCompRequest{Name: ical.CompCalendar, AllProps: true, AllComps: true},
+			CompFilter: caldav.CompFilter{
+				Name:  ical.CompCalendar,
+				Comps: []caldav.CompFilter{{Name: compAvailability}},
+			},
+		}
+
+		var components []*ical.Component
+		for _, cal := range calendars {
+			objects, err := caldavClient.QueryCalendar(ctx, cal, query)
+			if err != nil {
+				// Calendars that cannot hold VAVAILABILITY may reject the query
+				log.Printf("Error querying availability in %s: %v", cal, err)
+				continue
+			}
+			for _, obj := range objects {
+				if obj.Data != nil {
+					components = append(components, componentsByName(obj.Data, compAvailability)...)
+				}
+			}
+		}
+		return components, nil
+	}
+}
+
+// componentsByName returns the top-level components with the given name
+func componentsByName(cal *ical.Calendar, name string) []*ical.Component {
+	var components []*ical.Component
+	for _, component := range cal.Children {
+		if component.Name == name {
+			components = append(components, component)
+		}
+	}
+	return components
+}
+
+// current returns the cached components, reloading them when stale
+func (s *vavailabilitySource) current(ctx context.Context) ([]*ical.Component, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.components != nil && time.Since(s.loadedAt) < s.refresh {
+		return s.components, nil
+	}
+
+	components, err := s.load(ctx)
+	if err != nil {
+		if s.components != nil {
+			// Keep serving the previously loaded components
+			log.Printf("Error reloading availability: %v", err)
+			return s.components, nil
+		}
+		return nil, err
+	}
+	if len(components) == 0 {
+		log.Printf("No %s components found", compAvailability)
+	}
+
+	s.components = components
+	s.loadedAt = time.Now()
+	return components, nil
+}
+
+// Windows applies VAVAILABILITY components from lowest to highest
+// priority. Within the period of a component only its AVAILABLE times are
+// bookable; time outside every component is not bookable.
+func (s *vavailabilitySource) Windows(ctx context.Context, start, end time.Time) ([]Interval, error) {
+	components, err := s.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group by priority, PRIORITY 1 is highest and 0 means undefined (lowest)
+	groups := make(map[int][]*ical.Component)
+	for _, component := range components {
+		groups[availabilityPriority(component)] = append(groups[availabilityPriority(component)], component)
+	}
+
+	priorities := make([]int, 0, len(groups))
+	for priority := range groups {
+		priorities = append(priorities, priority)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+
+	var windows []Interval
+	for _, priority := range priorities {
+		var covered, available []Interval
+		for _, component := range groups[priority] {
+			period, ok := availabilityPeriod(component, start, end)
+			if !ok {
+				continue
+			}
+			covered = append(covered, period)
+
+			var children []*ical.Component
+			for _, child := range component.Children {
+				if child.Name == compAvailable {
+					children = append(children, child)
+				}
+			}
+			available = append(available, clipIntervals(componentIntervals(children, period.Start, period.End), period.Start, period.End)...)
+		}
+
+		// Higher priority components replace whatever was decided before
+		windows = subtractIntervals(windows, mergeIntervals(covered))
+		windows = mergeIntervals(append(windows, available...))
+	}
+
+	return windows, nil
+}
+
+// availabilityPriority maps PRIORITY so that larger numbers mean lower priority
+func availabilityPriority(component *ical.Component) int {
+	prop := component.Props.Get(ical.PropPriority)
+	if prop == nil {
+		return 10
+	}
+	priority, err := prop.Int()
+	if err != nil || priority <= 0 || priority > 9 {
+		return 10
+	}
+	return priority
+}
+
+// availabilityPeriod returns the part of the range covered by a
+// VAVAILABILITY component; missing DTSTART or DTEND means unbounded
+func availabilityPeriod(component *ical.Component, start, end time.Time) (Interval, bool) {
+	period := Interval{Start: start, End: end}
+
+	var componentStart time.Time
+	if dtstart := component.Props.Get(ical.PropDateTimeStart); dtstart != nil {
+		t, err := dtstart.DateTime(time.UTC)
+		if err != nil {
+			return Interval{}, false
+		}
+		componentStart = t
+		if t.After(period.Start) {
+			period.Start = t
+		}
+	}
+
+	componentEnd := time.Time{}
+	if dtend := component.Props.Get(ical.PropDateTimeEnd); dtend != nil {
+		t, err := dtend.DateTime(time.UTC)
+		if err != nil {
+			return Interval{}, false
+		}
+		componentEnd = t
+	} else if prop := component.Props.Get(ical.PropDuration); prop != nil && !componentStart.IsZero() {
+		if duration, err := prop.Duration(); err == nil {
+			componentEnd = componentStart.Add(duration)
+		}
+	}
+	if !componentEnd.IsZero() && componentEnd.Before(period.End) {
+		period.End = componentEnd
+	}
+
+	return period, period.Start.Before(period.End)
+}
+
+// subtractIntervals removes the time of b from a; b must be merged
+func subtractIntervals(a, b []Interval) []Interval {
+	var result []Interval
+	for _, interval := range a {
+		pieces := []Interval{interval}
+		for _, cut := range b {
+			var next []Interval
+			for _, piece := range pieces {
+				if !piece.Overlaps(cut) {
+					next = append(next, piece)
+					continue
+				}
+				if piece.Start.Before(cut.Start) {
+					next = append(next, Interval{Start: piece.Start, End: cut.Start})
+				}
+				if piece.End.After(cut.End) {
+					next = append(next, Interval{Start: cut.End, End: piece.End})
+				}
+			}
+			pieces = next
+		}
+		result = append(result, pieces...)
+	}
+	return result
+}
+
+// String describes the source for logs
+func (s *vavailabilitySource) String() string {
+	if AvailabilityResource == "" {
+		return fmt.Sprintf("%s components in the calendar home", compAvailability)
+	}
+	return fmt.Sprintf("%s components in %s", compAvailability, AvailabilityResource)
+}
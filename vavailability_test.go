@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-ical"
+)
+
+// Office hours on weekdays, 09:00-17:00 UTC, without a priority
+const officeHours = `BEGIN:VAVAILABILITY
+UID:office
+DTSTAMP:20260101T000000Z
+BEGIN:AVAILABLE
+UID:office-weekdays
+DTSTAMP:20260101T000000Z
+DTSTART:20261005T090000Z
+DTEND:20261005T170000Z
+RRULE:FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR
+END:AVAILABLE
+END:VAVAILABILITY`
+
+func availabilityComponents(t *testing.T, components ...string) []*ical.Component {
+	t.Helper()
+
+	text := "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:-//test//EN\n" + strings.Join(components, "\n") + "\nEND:VCALENDAR"
+	text = strings.ReplaceAll(text, "\n", "\r\n") + "\r\n"
+	parsed, err := parseICSComponents(strings.NewReader(text), compAvailability)
+	if err != nil {
+		t.Fatalf("parsing components: %v", err)
+	}
+	return parsed
+}
+
+func TestVAvailabilityWindows(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []string
+		want       []string
+	}{
+		{
+			name:       "single component",
+			components: []string{officeHours},
+			want:       []string{"2026-10-19 09:00-17:00", "2026-10-20 09:00-17:00", "2026-10-21 09:00-17:00"},
+		},
+		{
+			name: "vacation without available blocks closes its days",
+			components: []string{officeHours, `BEGIN:VAVAILABILITY
+UID:vacation
+DTSTAMP:20260101T000000Z
+PRIORITY:1
+DTSTART:20261020T000000Z
+DTEND:20261021T000000Z
+END:VAVAILABILITY`},
+			want: []string{"2026-10-19 09:00-17:00", "2026-10-21 09:00-17:00"},
+		},
+		{
+			name: "higher priority replaces the hours it covers",
+			components: []string{officeHours, `BEGIN:VAVAILABILITY
+UID:short-day
+DTSTAMP:20260101T000000Z
+PRIORITY:5
+DTSTART:20261020T000000Z
+DTEND:20261021T000000Z
+BEGIN:AVAILABLE
+UID:short-day-block
+DTSTAMP:20260101T000000Z
+DTSTART:20261020T120000Z
+DTEND:20261020T140000Z
+END:AVAILABLE
+END:VAVAILABILITY`},
+			want: []string{"2026-10-19 09:00-17:00", "2026-10-20 12:00-14:00", "2026-10-21 09:00-17:00"},
+		},
+		{
+			name: "highest priority wins over a middle one",
+			components: []string{officeHours, `BEGIN:VAVAILABILITY
+UID:middle
+DTSTAMP:20260101T000000Z
+PRIORITY:5
+DTSTART:20261019T000000Z
+DTEND:20261022T000000Z
+END:VAVAILABILITY`, `BEGIN:VAVAILABILITY
+UID:top
+DTSTAMP:20260101T000000Z
+PRIORITY:2
+DTSTART:20261021T000000Z
+DTEND:20261022T000000Z
+BEGIN:AVAILABLE
+UID:top-block
+DTSTAMP:20260101T000000Z
+DTSTART:20261021T100000Z
+DTEND:20261021T110000Z
+END:AVAILABLE
+END:VAVAILABILITY`},
+			want: []string{"2026-10-21 10:00-11:00"},
+		},
+		{
+			name: "same priority components add up",
+			components: []string{officeHours, `BEGIN:VAVAILABILITY
+UID:evenings
+DTSTAMP:20260101T000000Z
+BEGIN:AVAILABLE
+UID:evening-block
+DTSTAMP:20260101T000000Z
+DTSTART:20261019T160000Z
+DTEND:20261019T200000Z
+END:AVAILABLE
+END:VAVAILABILITY`},
+			want: []string{"2026-10-19 09:00-20:00", "2026-10-20 09:00-17:00", "2026-10-21 09:00-17:00"},
+		},
+		{
+			name: "time outside every component is closed",
+			components: []string{`BEGIN:VAVAILABILITY
+UID:from-tuesday
+DTSTAMP:20260101T000000Z
+DTSTART:20261020T000000Z
+BEGIN:AVAILABLE
+UID:from-tuesday-block
+DTSTAMP:20260101T000000Z
+DTSTART:20261005T090000Z
+DTEND:20261005T170000Z
+RRULE:FREQ=DAILY
+END:AVAILABLE
+END:VAVAILABILITY`},
+			want: []string{"2026-10-20 09:00-17:00", "2026-10-21 09:00-17:00"},
+		},
+	}
+
+	start := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 10, 22, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			components := availabilityComponents(t, test.components...)
+			source := &vavailabilitySource{
+				load: func(ctx context.Context) ([]*ical.Component, error) {
+					return components, nil
+				},
+				refresh: time.Hour,
+			}
+
+			windows, err := source.Windows(context.Background(), start, end)
+			if err != nil {
+				t.Fatalf("Windows: %v", err)
+			}
+			var got []string
+			for _, window := range windows {
+				got = append(got, window.Start.Format("2006-01-02 15:04")+"-"+window.End.Format("15:04"))
+			}
+			if strings.Join(got, ",") != strings.Join(test.want, ",") {
+				t.Errorf("windows = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Webhook event names
+const (
+	webhookCreated     = "booking.created"
+	webhookCancelled   = "booking.cancelled"
+	webhookRescheduled = "booking.rescheduled"
+	webhookReconciled  = "booking.reconciled"
+)
+
+// webhookEvents maps notification events to webhook events
+var webhookEvents = map[string]string{
+	notifyConfirmed:      webhookCreated,
+	notifyCancelled:      webhookCancelled,
+	notifyRescheduled:    webhookRescheduled,
+	notifyMoved:          webhookReconciled,
+	notifyOwnerCancelled: webhookReconciled,
+	notifyDeclined:       webhookReconciled,
+}
+
+var (
+	WebhookMaxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", 5) // Deliveries tried per event, with doubling delays
+	AdminToken         = getEnvSecret("ADMIN_TOKEN", "")      // Bearer token for the admin API, off if unset
+
+	webhooks []*Webhook
+)
+
+// webhookRetryDelay is the wait before the second attempt, doubled after
+// every further failure
+const webhookRetryDelay = 10 * time.Second
+
+// deliveryLogSize is how many deliveries the delivery log keeps
+const deliveryLogSize = 200
+
+// Webhook is an HTTP endpoint receiving booking lifecycle events
+type Webhook struct {
+	Name   string
+	URL    string
+	Secret string
+	Events []string // Webhook events to send, all if empty
+
+	client *http.Client
+}
+
+// WebhookBooking is the booking as sent in webhook payloads
+type WebhookBooking struct {
+	Date        string    `json:"date"`
+	Time        string    `json:"time"`
+	Topic       string    `json:"topic"`
+	FullName    string    `json:"fullName"`
+	ContactInfo string    `json:"contactInfo"`
+	Contacts    []Contact `json:"contacts,omitempty"`
+	MeetingType string    `json:"meetingType"`
+	Duration    int       `json:"duration"`
+	Timezone    string    `json:"timezone,omitempty"`
+	Language    string    `json:"language,omitempty"`
+	Guests      []string  `json:"guests,omitempty"`
+	Location    string    `json:"location,omitempty"`
+	VideoURL    string    `json:"videoUrl,omitempty"`
+	Answers     []Answer  `json:"answers,omitempty"`
+	Code        string    `json:"code"`
+	UID         string    `json:"uid"`
+	Seat        bool      `json:"seat"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+}
+
+// WebhookPayload is the JSON body of a webhook request
+type WebhookPayload struct {
+	ID        string         `json:"id"`
+	Event     string         `json:"event"`
+	Change    string         `json:"change,omitempty"` // What the owner did, for booking.reconciled
+	Reason    string         `json:"reason,omitempty"`
+	Timestamp time.Time      `json:"timestamp"`
+	Booking   WebhookBooking `json:"booking"`
+}
+
+// Delivery records the attempts to send one event to one webhook
+type Delivery struct {
+	ID       string            `json:"id"`
+	Webhook  string            `json:"webhook"`
+	Event    string            `json:"event"`
+	Code     string            `json:"code"`
+	Status   string            `json:"status"` // pending, delivered or failed
+	Attempts []DeliveryAttempt `json:"attempts"`
+}
+
+// DeliveryAttempt is one HTTP request of a delivery
+type DeliveryAttempt struct {
+	Time       time.Time `json:"time"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"durationMs"`
+}
+
+var (
+	deliveries      []*Delivery
+	deliveriesMutex sync.Mutex
+)
+
+// loadWebhooks reads WEBHOOK_<N>_* variables starting at N=1 until the
+// first missing URL
+func loadWebhooks() []*Webhook {
+	var hooks []*Webhook
+	for i := 1; ; i++ {
+		prefix := fmt.Sprintf("WEBHOOK_%d_", i)
+		url := getEnvStr(prefix+"URL", "")
+		if url == "" {
+			break
+		}
+
+		hook := &Webhook{
+			Name:   getEnvStr(prefix+"NAME", fmt.Sprintf("webhook-%d", i)),
+			URL:    url,
+			Secret: getEnvSecret(prefix+"SECRET", ""),
+			client: &http.Client{Timeout: 15 * time.Second},
+		}
+		for _, event := range getEnvStrSlice(prefix+"EVENTS", "") {
+			if event = strings.TrimSpace(event); event != "" {
+				hook.Events = append(hook.Events, event)
+			}
+		}
+		if hook.Secret == "" {
+			log.Printf("Webhook %s has no secret, its requests are not signed", hook.Name)
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks
+}
+
+// initWebhooks registers the configured webhooks as a notifier
+func initWebhooks() {
+	webhooks = loadWebhooks()
+	if len(webhooks) > 0 {
+		notifiers = append(notifiers, webhookNotifier{})
+		log.Printf("Sending booking events to %d webhooks", len(webhooks))
+	}
+}
+
+// wants reports whether the webhook subscribed to the event
+func (h *Webhook) wants(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookNotifier turns booker-facing notifications into webhook events
+type webhookNotifier struct{}
+
+func (webhookNotifier) Notify(ctx context.Context, n Notification) error {
+	event, ok := webhookEvents[n.Event]
+	if !ok || n.Owner {
+		return nil
+	}
+
+	payload := WebhookPayload{
+		Event:     event,
+		Reason:    n.Reason,
+		Timestamp: time.Now().UTC(),
+		Booking:   webhookBooking(n.Booking),
+	}
+	if event == webhookReconciled {
+		payload.Change = n.Event
+	}
+
+	for _, hook := range webhooks {
+		if hook.wants(event) {
+			payload.ID = uuid.New().String()
+			go hook.deliver(payload)
+		}
+	}
+	return nil
+}
+
+func webhookBooking(b Booking) WebhookBooking {
+	wb := WebhookBooking{
+		Date:        b.Date,
+		Time:        b.Time,
+		Topic:       b.Topic,
+		FullName:    b.FullName,
+		ContactInfo: b.ContactInfo,
+		Contacts:    b.Contacts,
+		MeetingType: b.MeetingType,
+		Duration:    b.Duration,
+		Timezone:    b.Timezone,
+		Language:    b.Language,
+		Guests:      b.Guests,
+		Location:    b.Location,
+		VideoURL:    b.VideoURL,
+		Answers:     b.Answers,
+		Code:        b.Code,
+		UID:         b.UID,
+		Seat:        b.Seat,
+	}
+	if start, err := time.Parse("2006-01-02 15:04", b.Date+" "+b.Time); err == nil {
+		wb.Start = start.UTC()
+		wb.End = start.Add(time.Duration(b.Duration) * time.Minute).UTC()
+	}
+	return wb
+}
+
+// deliver sends the payload, retrying with doubling delays until the
+// endpoint answers with a 2xx status or WEBHOOK_MAX_ATTEMPTS is reached
+func (h *Webhook) deliver(payload WebhookPayload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Error encoding webhook payload: %v", err)
+		return
+	}
+
+	delivery := &Delivery{
+		ID:      payload.ID,
+		Webhook: h.Name,
+		Event:   payload.Event,
+		Code:    payload.Booking.Code,
+		Status:  "pending",
+	}
+	recordDelivery(delivery)
+
+	delay := webhookRetryDelay
+	for attempt := 1; ; attempt++ {
+		result := h.send(payload, body)
+		ok := result.Error == "" && result.StatusCode >= 200 && result.StatusCode < 300
+
+		deliveriesMutex.Lock()
+		delivery.Attempts = append(delivery.Attempts, result)
+		switch {
+		case ok:
+			delivery.Status = "delivered"
+		case attempt >= WebhookMaxAttempts:
+			delivery.Status = "failed"
+		}
+		deliveriesMutex.Unlock()
+
+		if ok {
+			return
+		}
+		if attempt >= WebhookMaxAttempts {
+			log.Printf("Giving up on webhook %s for %s after %d attempts", h.Name, payload.Event, attempt)
+			return
+		}
+
+		log.Printf("Webhook %s attempt %d failed (%d %s), retrying in %s",
+			h.Name, attempt, result.StatusCode, result.Error, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// send makes one signed request. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" with the webhook secret.
+func (h *Webhook) send(payload WebhookPayload, body []byte) DeliveryAttempt {
+	started := time.Now()
+	attempt := DeliveryAttempt{Time: started.UTC()}
+
+	req, err := http.NewRequest(http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	timestamp := strconv.FormatInt(started.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "BookMyMeet-Webhook")
+	req.Header.Set("X-BookMyMeet-Event", payload.Event)
+	req.Header.Set("X-BookMyMeet-Delivery", payload.ID)
+	req.Header.Set("X-BookMyMeet-Timestamp", timestamp)
+	if h.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.Secret))
+		mac.Write([]byte(timestamp + "."))
+		mac.Write(body)
+		req.Header.Set("X-BookMyMeet-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := h.client.Do(req)
+	attempt.DurationMS = time.Since(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	return attempt
+}
+
+// recordDelivery adds a delivery to the log, dropping the oldest entries
+func recordDelivery(d *Delivery) {
+	deliveriesMutex.Lock()
+	defer deliveriesMutex.Unlock()
+
+	deliveries = append(deliveries, d)
+	if len(deliveries) > deliveryLogSize {
+		deliveries = deliveries[len(deliveries)-deliveryLogSize:]
+	}
+}
+
+// registerAdminRoutes adds the admin API, available when ADMIN_TOKEN is set
+func registerAdminRoutes(r *mux.Router) {
+	if AdminToken == "" {
+		return
+	}
+	r.HandleFunc("/api/admin/webhooks/deliveries", requireAdmin(webhookDeliveries)).Methods("GET")
+	r.HandleFunc("/api/admin/invitations/reply", requireAdmin(invitationReply)).Methods("POST")
+}
+
+// requireAdmin checks the ADMIN_TOKEN bearer token
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) != 1 {
+			audit("admin_auth_failed", map[string]string{"ip": clientIP(r), "path": r.URL.Path})
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// webhookDeliveries lists the logged deliveries, newest first
+func webhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	deliveriesMutex.Lock()
+	list := make([]Delivery, 0, len(deliveries))
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		d := *deliveries[i]
+		d.Attempts = append([]DeliveryAttempt(nil), d.Attempts...)
+		list = append(list, d)
+	}
+	deliveriesMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}